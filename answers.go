@@ -0,0 +1,182 @@
+package funson
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+type ErrorMissingAnswer struct{ Question Question }
+
+func (e ErrorMissingAnswer) Error() string {
+	if e.Question.ID != "" {
+		return fmt.Sprintf("no answer for question %q with id %q", e.Question.Text, e.Question.ID)
+	}
+	return fmt.Sprintf("no answer for question %q", e.Question.Text)
+}
+
+type ErrorInvalidAnswer struct {
+	Question Question
+	Answer   string
+	Reason   string
+}
+
+func (e ErrorInvalidAnswer) Error() string {
+	return fmt.Sprintf("answer %q for question %q is not valid: %s", e.Answer, e.Question.Text, e.Reason)
+}
+
+// Prompter answering questions from prepared answers, so interactive programs can run without user.
+// Question takes answers given for its ID, or for its text if there are none for the ID, in order they are given.
+// Questions without answers for their ID or text take the answers given in sequence.
+// Answer which is not valid fails the program with ErrorInvalidAnswer, question without answer left fails it with ErrorMissingAnswer.
+// Answer of choice can be the number of option, or its text.
+type AnswersPrompter struct {
+	mu       sync.Mutex
+	keyed    map[string][]string
+	sequence []string
+	// The last question and its answer, for error returned by Show.
+	last       Question
+	lastAnswer string
+}
+
+// Returns prompter with answers "keyed" by question ID or text and answers in "sequence".
+func NewAnswersPrompter(keyed map[string][]string, sequence ...string) *AnswersPrompter {
+	p := &AnswersPrompter{keyed: make(map[string][]string, len(keyed)), sequence: append([]string(nil), sequence...)}
+	for k, answers := range keyed {
+		p.keyed[k] = append([]string(nil), answers...)
+	}
+	return p
+}
+
+// Returns prompter with answers decoded from JSON in "r".
+// JSON array holds answers in sequence, JSON object holds answers by question ID or text. Answer of object is single answer, or array of answers for question asked repeatedly.
+// Answers are strings, numbers, booleans, or null for empty answer.
+func ReadAnswers(r io.Reader) (*AnswersPrompter, error) {
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	var data interface{}
+	if err := d.Decode(&data); err != nil {
+		return nil, fmt.Errorf("answers: %w", err)
+	}
+	switch dt := data.(type) {
+	case []interface{}:
+		sequence, err := answerList(dt)
+		if err != nil {
+			return nil, err
+		}
+		return NewAnswersPrompter(nil, sequence...), nil
+	case map[string]interface{}:
+		keyed := make(map[string][]string, len(dt))
+		for k, v := range dt {
+			list, ok := v.([]interface{})
+			if !ok {
+				list = []interface{}{v}
+			}
+			answers, err := answerList(list)
+			if err != nil {
+				return nil, fmt.Errorf("%w for question %q", err, k)
+			}
+			keyed[k] = answers
+		}
+		return NewAnswersPrompter(keyed), nil
+	}
+	return nil, fmt.Errorf("answers: want array or object of answers, got %s", jsonType(data))
+}
+
+// Returns JSON values "list" as answers.
+func answerList(list []interface{}) ([]string, error) {
+	answers := make([]string, len(list))
+	for i, v := range list {
+		switch vt := v.(type) {
+		case nil:
+		case string:
+			answers[i] = vt
+		case json.Number:
+			answers[i] = vt.String()
+		case bool:
+			answers[i] = strconv.FormatBool(vt)
+		default:
+			return nil, fmt.Errorf("answers: want string, number, boolean or null answer, got %s", jsonType(v))
+		}
+	}
+	return answers, nil
+}
+
+// Returns name of JSON type of decoded value "v".
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	return "number"
+}
+
+// Returns next answer to question "q".
+func (p *AnswersPrompter) answer(ctx context.Context, q Question) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key, ok := q.ID, false
+	if key != "" {
+		_, ok = p.keyed[key]
+	}
+	if !ok {
+		key = q.Text
+		_, ok = p.keyed[key]
+	}
+	answers := p.sequence
+	if ok {
+		answers = p.keyed[key]
+	}
+	if len(answers) == 0 {
+		return "", ErrorMissingAnswer{Question: q}
+	}
+	a := answers[0]
+	if ok {
+		p.keyed[key] = answers[1:]
+	} else {
+		p.sequence = answers[1:]
+	}
+	p.last, p.lastAnswer = q, a
+	return a, nil
+}
+
+func (p *AnswersPrompter) Ask(ctx context.Context, q Question) (string, error) {
+	return p.answer(ctx, q)
+}
+
+func (p *AnswersPrompter) AskChoice(ctx context.Context, q Question) (string, error) {
+	a, err := p.answer(ctx, q)
+	if err != nil {
+		return "", err
+	}
+	if _, err := strconv.Atoi(a); err == nil {
+		return a, nil
+	}
+	for i, option := range q.Options {
+		if option == a {
+			return strconv.Itoa(i + 1), nil
+		}
+	}
+	return a, nil
+}
+
+// Returns ErrorInvalidAnswer for the last answer, because functions show message only if the answer was not accepted.
+func (p *AnswersPrompter) Show(_ context.Context, msg string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return ErrorInvalidAnswer{Question: p.last, Answer: p.lastAnswer, Reason: msg}
+}
@@ -0,0 +1,94 @@
+package funson
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnswersPrompter(t *testing.T) {
+	name := map[string]interface{}{"id": "name", "question": "Your name"}
+	age := map[string]interface{}{"question": "Age", "type": "integer", "validator": "^[0-9]+$", "condition": "Digits only"}
+	pick := map[string]interface{}{"question": "Pick", "options": []interface{}{"a", "b", "c"}, "predefined": "none"}
+	tests := []struct {
+		name    string
+		answers string
+		input   interface{}
+		want    interface{}
+		wantErr error
+	}{
+		{
+			name:    "sequence",
+			answers: `["x", 12, "2"]`,
+			input:   []interface{}{[]interface{}{"!input", name}, []interface{}{"!input", age}, []interface{}{"!choose", pick}},
+			want:    []interface{}{"x", 12, "b"},
+		},
+		{
+			name:    "by id and text",
+			answers: `{"Pick": "c", "Age": [" 1 ", 2], "name": "x", "Your name": "not used"}`,
+			input:   []interface{}{[]interface{}{"!choose", pick}, []interface{}{"!input", age}, []interface{}{"!input", name}, []interface{}{"!input", age}},
+			want:    []interface{}{"c", 1, "x", 2},
+		},
+		{
+			name:    "empty answer",
+			answers: `[null, ""]`,
+			input:   []interface{}{[]interface{}{"!choose", pick}, []interface{}{"!input", map[string]interface{}{"predefined": "p"}}},
+			want:    []interface{}{"none", "p"},
+		},
+		{
+			name:    "missing",
+			answers: `{"Age": [1]}`,
+			input:   []interface{}{[]interface{}{"!input", age}, []interface{}{"!input", age}},
+			wantErr: ErrorMissingAnswer{Question: Question{Text: "Age"}},
+		},
+		{
+			name:    "missing with id",
+			answers: `[]`,
+			input:   []interface{}{"!input", name},
+			wantErr: ErrorMissingAnswer{Question: Question{ID: "name", Text: "Your name"}},
+		},
+		{
+			name:    "not valid",
+			answers: `["1a"]`,
+			input:   []interface{}{"!input", age},
+			wantErr: ErrorInvalidAnswer{Question: Question{Text: "Age"}, Answer: "1a", Reason: "Entered value doesn't pass condition.\nDigits only"},
+		},
+		{
+			name:    "not valid choice",
+			answers: `[4]`,
+			input:   []interface{}{"!choose", pick},
+			wantErr: ErrorInvalidAnswer{Question: Question{Text: "Pick", Options: []string{"a", "b", "c"}}, Answer: "4", Reason: "Choose a number from list."},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := ReadAnswers(strings.NewReader(tc.answers))
+			if err != nil {
+				t.Fatalf("ReadAnswers(%s) error = %v", tc.answers, err)
+			}
+			in := New()
+			in.Prompter = p
+			got, err := in.Fun(tc.input)
+			if tc.wantErr != nil {
+				var evalErr *EvalError
+				if !errors.As(err, &evalErr) || !reflect.DeepEqual(evalErr.Err, tc.wantErr) {
+					t.Fatalf("Fun(%v) error = %v, want %v", tc.input, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Fun(%v) = (%#v, %v), want (%#v, nil)", tc.input, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadAnswersErrors(t *testing.T) {
+	for _, answers := range []string{``, `"a"`, `[["a"]]`, `{"a": {"b": 1}}`, `{"a": [[1]]}`} {
+		if _, err := ReadAnswers(strings.NewReader(answers)); err == nil {
+			t.Errorf("ReadAnswers(%s) error = nil, want error", answers)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package funson
+
+import "time"
+
+// Returns clock for Now of interpreter, which always returns time "t".
+func FixedClock(t time.Time) func() time.Time {
+	return func() time.Time {
+		return t
+	}
+}
+
+// Returns clock for Now of interpreter, which returns time of "clock" moved by "offset". Real clock is used if "clock" is nil.
+func OffsetClock(clock func() time.Time, offset time.Duration) func() time.Time {
+	if clock == nil {
+		clock = time.Now
+	}
+	return func() time.Time {
+		return clock().Add(offset)
+	}
+}
+
+// Returns current time of the interpreter's clock, real time if Now is nil.
+func (i *Interpreter) now() time.Time {
+	if i.Now == nil {
+		return time.Now()
+	}
+	return i.Now()
+}
+
+// Returns current time of the interpreter's clock.
+// Functions depending on current time should use it, so programs can be run with fixed or moved time.
+func (en *EnviromentNode) Now() time.Time {
+	return en.Interpreter().now()
+}
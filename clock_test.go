@@ -0,0 +1,44 @@
+package funson
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	fixed := time.Date(2026, time.January, 2, 15, 4, 5, 0, time.UTC)
+	program := []interface{}{"!time.Format", []interface{}{"!time.Now"}, time.RFC3339}
+	tests := []struct {
+		name  string
+		clock func() time.Time
+		want  string
+		// Real time differs between calls, only day is compared.
+		onlyDay bool
+	}{
+		{"fixed", FixedClock(fixed), "2026-01-02T15:04:05Z", false},
+		{"offset", OffsetClock(FixedClock(fixed), -25*time.Hour), "2026-01-01T14:04:05Z", false},
+		{"real", nil, time.Now().UTC().Format("2006-01-02"), true},
+		{"real offset", OffsetClock(nil, 24*time.Hour), time.Now().UTC().Add(24 * time.Hour).Format("2006-01-02"), true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			in := New()
+			in.Now = tc.clock
+			got, err := in.Fun(program)
+			if err != nil {
+				t.Fatalf("Fun(%v) error = %v", program, err)
+			}
+			s, _ := got.(string)
+			if tc.onlyDay {
+				if parsed, err := time.Parse(time.RFC3339, s); err != nil || parsed.UTC().Format("2006-01-02") != tc.want {
+					t.Errorf("Fun(%v) = %#v, want day %s", program, got, tc.want)
+				}
+				return
+			}
+			if s != tc.want {
+				t.Errorf("Fun(%v) = %#v, want %#v", program, got, tc.want)
+			}
+		})
+	}
+}
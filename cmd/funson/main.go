@@ -1,11 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/jezek/funson"
 )
@@ -13,16 +21,46 @@ import (
 func main() {
 	flag.Usage = func() {
 		defer os.Exit(1)
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s SOURCE\n", flag.CommandLine.Name())
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [OPTIONS] SOURCE\n", flag.CommandLine.Name())
+		fmt.Fprintf(flag.CommandLine.Output(), "   or: %s -list-functions [-json]\n", flag.CommandLine.Name())
 		fmt.Fprintf(flag.CommandLine.Output(), "Run funson program in SOURCE and prints result to standart output.\n")
 		flag.PrintDefaults()
 	}
+	listFunctions := flag.Bool("list-functions", false, "Print available functions with their descriptions to standard output and exit.")
+	listJSON := flag.Bool("json", false, "Print list of functions as JSON, with -list-functions option.")
+	path := flag.String("path", "", "Directories (separated by \""+string(os.PathListSeparator)+"\") searched for files loaded by import and include functions, after the directory of the loading file.")
+	lenient := flag.Bool("lenient", false, "Ignore leftover arguments of functions, which are not variadic, instead of failing.")
+	prompts := flag.String("prompts", "stderr", "Where to write questions of interactive functions: \"stderr\", \"tty\" (terminal of the process) or \"stdout\". Answers are read from standard input.")
+	answers := flag.String("answers", "", "JSON file with answers for interactive functions, used instead of asking user. Missing or not valid answer fails the program.")
+	record := flag.String("record", "", "Write questions, answers and times of the run to JSON session file, also if the run fails.")
+	replay := flag.String("replay", "", "Run again with questions answered and times taken from JSON session file written by -record option. The run fails if it asks question not in the session.")
+	now := flag.String("now", "", "Current time for the program, in RFC 3339 format (e.g. 2026-01-02T15:04:05Z), or real time moved by signed duration (e.g. -48h). Real time if empty.")
+	logLevel := flag.String("log-level", "info", "Lowest level of logged messages of log function: \"debug\", \"info\", \"warn\", \"error\" or \"off\".")
+	logFile := flag.String("log-file", "", "Append messages of log function to file instead of writing them to standard error.")
+	parallelism := flag.Int("parallelism", 0, "Maximum number of items processed concurrently by parallel function, 0 means number of CPUs.")
+	limits := funson.Limits{}
+	flag.IntVar(&limits.Steps, "max-steps", 0, "Maximum number of processed program nodes, 0 means no limit.")
+	flag.IntVar(&limits.Depth, "max-depth", 0, "Maximum depth of nested function calls, 0 means the internal maximum of 2000.")
+	flag.IntVar(&limits.Iterations, "max-iterations", 0, "Maximum number of iterations of one loop, 0 means no limit.")
+	flag.IntVar(&limits.ResultSize, "max-result-size", 0, "Maximum number of values in result, 0 means no limit.")
 
 	flag.Parse()
 
+	if *listFunctions {
+		if err := printFunctions(os.Stdout, *listJSON); err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "Can't print functions: %s\n", err)
+			os.Exit(5)
+		}
+		return
+	}
+
 	if flag.NArg() != 1 {
 		flag.Usage()
 	}
+	if *replay != "" && (*answers != "" || *record != "" || *now != "") {
+		fmt.Fprintf(flag.CommandLine.Output(), "Option -replay can't be used with -answers, -record or -now.\n")
+		flag.Usage()
+	}
 
 	source := flag.Arg(0)
 
@@ -38,9 +76,113 @@ func main() {
 		os.Exit(3)
 	}
 
-	result, err := funson.Fun(input)
+	var promptOut io.Writer
+	switch *prompts {
+	case "stderr":
+		promptOut = os.Stderr
+	case "stdout":
+		promptOut = os.Stdout
+	case "tty":
+		tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+		if err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "Can't open terminal for prompts: %s\n", err)
+			os.Exit(1)
+		}
+		// The terminal is written to until the end of the process, it is closed by exit.
+		promptOut = tty
+	default:
+		fmt.Fprintf(flag.CommandLine.Output(), "Unknown prompts stream: %s\n", *prompts)
+		flag.Usage()
+	}
+
+	interpreter := funson.New()
+	// Questions don't go to standard output by default, so it holds only the result.
+	interpreter.Prompter = funson.NewTerminalPrompter(os.Stdin, promptOut)
+	if *answers != "" {
+		f, err := os.Open(*answers)
+		if err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "Can't read answers file: %s\n", err)
+			os.Exit(2)
+		}
+		p, err := funson.ReadAnswers(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "Can't read answers file: %s\n", err)
+			os.Exit(3)
+		}
+		interpreter.Prompter = p
+	}
+	if *now != "" {
+		clock, err := parseClock(*now)
+		if err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "Wrong -now option: %s\n", err)
+			flag.Usage()
+		}
+		interpreter.Now = clock
+	}
+	level, err := funson.ParseLogLevel(*logLevel)
 	if err != nil {
-		fmt.Fprintf(flag.CommandLine.Output(), "Runtime error: %s\n", err)
+		fmt.Fprintf(flag.CommandLine.Output(), "Wrong -log-level option: %s\n", err)
+		flag.Usage()
+	}
+	interpreter.LogLevel = level
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "Can't open log file: %s\n", err)
+			os.Exit(2)
+		}
+		// Messages are written unbuffered until the end of the process, the file is closed by exit.
+		interpreter.Logger = funson.NewWriterLogger(f)
+	}
+	var replayer *funson.Replayer
+	if *replay != "" {
+		f, err := os.Open(*replay)
+		if err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "Can't read session file: %s\n", err)
+			os.Exit(2)
+		}
+		session, err := funson.ReadSession(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "Can't read session file: %s\n", err)
+			os.Exit(3)
+		}
+		replayer = funson.Replay(interpreter, session)
+	}
+	var recorder *funson.Recorder
+	if *record != "" {
+		recorder = funson.Record(interpreter)
+	}
+	interpreter.Path = filepath.SplitList(*path)
+	interpreter.Lenient = *lenient
+	interpreter.Limits = limits
+	interpreter.Parallelism = *parallelism
+
+	// Interrupt stops the program with error, so the failing place is reported.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	result, err := interpreter.FunSourceContext(ctx, source, input)
+	if recorder != nil {
+		if err := writeSession(*record, recorder.Session()); err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "Can't write session file: %s\n", err)
+			os.Exit(6)
+		}
+	}
+	if err == nil && replayer != nil {
+		err = replayer.Err()
+		if rest := replayer.Remaining(); err == nil && len(rest) > 0 {
+			err = fmt.Errorf("%d events of session were not replayed", len(rest))
+		}
+	}
+	if err != nil {
+		var evalErr *funson.EvalError
+		if errors.As(err, &evalErr) {
+			fmt.Fprintf(flag.CommandLine.Output(), "Runtime error: %s", evalErr.Trace())
+		} else {
+			fmt.Fprintf(flag.CommandLine.Output(), "Runtime error: %s\n", err)
+		}
 		os.Exit(4)
 	}
 
@@ -52,3 +194,54 @@ func main() {
 
 	fmt.Println(string(output))
 }
+
+// Writes "session" to file "name".
+func writeSession(name string, session *funson.Session) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := session.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Returns clock of option "now", which is time in RFC 3339 format or signed duration of real time.
+func parseClock(now string) (func() time.Time, error) {
+	if strings.HasPrefix(now, "+") || strings.HasPrefix(now, "-") {
+		d, err := time.ParseDuration(now)
+		if err != nil {
+			return nil, err
+		}
+		return funson.OffsetClock(nil, d), nil
+	}
+	t, err := time.Parse(time.RFC3339, now)
+	if err != nil {
+		return nil, err
+	}
+	return funson.FixedClock(t), nil
+}
+
+// Writes functions available to programs to "w", as JSON array if "asJSON" is true.
+func printFunctions(w io.Writer, asJSON bool) error {
+	functions := funson.New().Functions()
+	if asJSON {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(functions)
+	}
+	bw := bufio.NewWriter(w)
+	for _, f := range functions {
+		fmt.Fprintf(bw, "%s\n", f)
+		for _, s := range []string{f.Description, f.Input, f.Output} {
+			if s != "" {
+				fmt.Fprintf(bw, "    %s\n", s)
+			}
+		}
+		fmt.Fprintln(bw)
+	}
+	// Errors of writes are kept by the writer and returned by Flush.
+	return bw.Flush()
+}
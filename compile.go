@@ -0,0 +1,316 @@
+package funson
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+// Program prepared by Compile to be run many times.
+// Function calls, their arguments and JSON Pointers of nodes are resolved once, when the program is compiled.
+// The program tree given to Compile must not be modified afterwards.
+type Program struct {
+	interpreter *Interpreter
+	// Absolute path of file the program was read from, empty if none.
+	file  string
+	in    interface{}
+	nodes map[nodeKey]*compiledNode
+}
+
+// Identity of array or object in program tree.
+type nodeKey struct {
+	ptr uintptr
+	// Length of array, -1 for object.
+	len int
+}
+
+// Returns identity of array or object "in", or false for other values.
+func nodeKeyOf(in interface{}) (nodeKey, bool) {
+	switch typed := in.(type) {
+	case []interface{}:
+		if len(typed) == 0 {
+			return nodeKey{}, false
+		}
+		return nodeKey{reflect.ValueOf(typed).Pointer(), len(typed)}, true
+	case map[string]interface{}:
+		return nodeKey{reflect.ValueOf(typed).Pointer(), -1}, true
+	}
+	return nodeKey{}, false
+}
+
+// Array or object of compiled program.
+type compiledNode struct {
+	// Function name and arguments, if the node is array function call.
+	name string
+	args []argNode
+	// Sorted keys, if the node is object.
+	keys []string
+	// JSON Pointers of array items, or of object values in order of keys.
+	pointers []string
+}
+
+// Returns compiled node of "in", or nil if the program run is not compiled or "in" is not part of compiled program.
+func (en *EnviromentNode) compiled(in interface{}) *compiledNode {
+	if en == nil || en.eval == nil || en.eval.program == nil {
+		return nil
+	}
+	k, ok := nodeKeyOf(in)
+	if !ok {
+		return nil
+	}
+	return en.eval.program.nodes[k]
+}
+
+// Compiles funson program "in" for the interpreter.
+// Calls of unknown functions and calls of built-in or added functions with wrong number or type of arguments, which can be found before running the program, are returned as *EvalError.
+// Calls, which may not be processed when the program runs (arguments of comment, branches of if, and, or, bodies of for, fn, def), and object form calls are not checked, they fail when run like with Fun.
+func (i *Interpreter) Compile(in interface{}) (*Program, error) {
+	return i.compile("", in)
+}
+
+// Compiles funson program "in" read from "source" file, like Compile.
+// Files loaded by the program with import and include functions are searched relative to the "source" file.
+func (i *Interpreter) CompileSource(source string, in interface{}) (*Program, error) {
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return nil, err
+	}
+	return i.compile(abs, in)
+}
+
+func (i *Interpreter) compile(file string, in interface{}) (*Program, error) {
+	c := &compiler{
+		p: &Program{
+			interpreter: i,
+			file:        file,
+			in:          in,
+			nodes:       map[nodeKey]*compiledNode{},
+		},
+		defined: map[string]bool{},
+	}
+	c.scan(in)
+	if err := c.compile(in, "", false); err != nil {
+		return nil, err
+	}
+	return c.p, nil
+}
+
+// Compiles funson program "in" for the default interpreter.
+func Compile(in interface{}) (*Program, error) {
+	return defaultInterpreter.Compile(in)
+}
+
+// Runs the program and returns its result.
+// Errors are returned as *EvalError.
+func (p *Program) Run() (interface{}, error) {
+	return p.RunContext(context.Background())
+}
+
+// Runs the program like Run, stopping with error when "ctx" is done.
+func (p *Program) RunContext(ctx context.Context) (interface{}, error) {
+	e := Enviroment{}
+	if p.file != "" {
+		e["file"] = p.file
+		e["imports"] = []string{p.file}
+	}
+	return p.interpreter.run(ctx, e, p.in, p)
+}
+
+type compiler struct {
+	p *Program
+	// Names of functions defined in program by def function, they can hide registered functions.
+	defined map[string]bool
+	// Program imports other files or defines functions with computed names, so any function name can be defined.
+	dynamic bool
+}
+
+// Finds functions defined in program "in".
+func (c *compiler) scan(in interface{}) {
+	switch typed := in.(type) {
+	case []interface{}:
+		if name, args := sliceFunc(typed); name != "" {
+			switch name {
+			case "def":
+				if len(args) > 0 {
+					c.define(args[0])
+				}
+			case "import":
+				c.dynamic = true
+			}
+		}
+		for _, v := range typed {
+			c.scan(v)
+		}
+	case map[string]interface{}:
+		if isMapFunc(typed) {
+			switch typed["!"] {
+			case "def":
+				c.define(typed["name"])
+			case "import":
+				c.dynamic = true
+			default:
+				if _, ok := typed["!"].(string); !ok {
+					c.dynamic = true
+				}
+			}
+		}
+		for _, v := range typed {
+			c.scan(v)
+		}
+	}
+}
+
+func (c *compiler) define(name interface{}) {
+	if n, ok := name.(string); ok {
+		c.defined[n] = true
+		return
+	}
+	c.dynamic = true
+}
+
+// Returns error of program node at "pointer".
+func (c *compiler) error(pointer string, err error) error {
+	return &EvalError{File: c.p.file, Pointer: pointer, Err: err}
+}
+
+// Arguments of built-in functions, which may be left unprocessed, from index of the first such argument, e.g. branches of if.
+var lazyArgs = map[string]int{
+	"if":   1,
+	"?and": 1,
+	"?or":  1,
+	"for":  1,
+	"fn":   1,
+	"def":  2,
+}
+
+// Compiles node "in" at "pointer" and all its descendants.
+// Errors of calls in "lazy" node, which may not be processed when the program runs, are left to be returned by the run.
+func (c *compiler) compile(in interface{}, pointer string, lazy bool) error {
+	switch typed := in.(type) {
+	case []interface{}:
+		k, ok := nodeKeyOf(typed)
+		if !ok {
+			return nil
+		}
+		if name, args := sliceFunc(typed); name != "" {
+			n := &compiledNode{name: name, args: make([]argNode, len(args))}
+			for i, arg := range args {
+				n.args[i] = argNode{value: arg, pointer: pointerJoin(pointer, i+1)}
+			}
+			if err := c.call(n, pointer); err != nil && !lazy {
+				return err
+			}
+			c.p.nodes[k] = n
+			if name == "comment" {
+				// Arguments of comment are never processed, they can be anything.
+				return nil
+			}
+			first, ok := lazyArgs[name]
+			for i, arg := range n.args {
+				if err := c.compile(arg.value, arg.pointer, lazy || ok && i >= first); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		n := &compiledNode{pointers: make([]string, len(typed))}
+		for i, v := range typed {
+			n.pointers[i] = pointerJoin(pointer, i)
+			if err := c.compile(v, n.pointers[i], lazy); err != nil {
+				return err
+			}
+		}
+		c.p.nodes[k] = n
+	case map[string]interface{}:
+		if isMapFunc(typed) && typed["!"] == "comment" {
+			return nil
+		}
+		keys := make([]string, 0, len(typed))
+		for k := range typed {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		n := &compiledNode{keys: keys, pointers: make([]string, len(keys))}
+		for i, k := range keys {
+			n.pointers[i] = pointerJoin(pointer, k)
+			// Object form calls are not checked, their arguments are bound to parameters when the program runs.
+			if err := c.compile(typed[k], n.pointers[i], lazy || isMapFunc(typed)); err != nil {
+				return err
+			}
+		}
+		if !isMapFunc(typed) {
+			k, _ := nodeKeyOf(typed)
+			c.p.nodes[k] = n
+		}
+	}
+	return nil
+}
+
+// Resolves function of array function call "n" at "pointer".
+// Arguments, which can be passed to registered function without processing, are converted ahead of time.
+// Returns error, if the call can be found wrong without running the program.
+func (c *compiler) call(n *compiledNode, pointer string) error {
+	if c.defined[n.name] || n.name[0] == '$' {
+		return nil
+	}
+	f, ok := c.p.interpreter.function(n.name)
+	if !ok {
+		if c.dynamic {
+			return nil
+		}
+		return c.error(pointer, fmt.Errorf("no function found: %s", n.name))
+	}
+
+	t := f.typ
+	fillInputsTo := t.NumIn()
+	if t.IsVariadic() {
+		fillInputsTo--
+	}
+	for i := range n.args {
+		var it reflect.Type
+		if i+1 < fillInputsTo {
+			it = t.In(i + 1)
+		} else if t.IsVariadic() {
+			it = t.In(t.NumIn() - 1).Elem()
+		} else {
+			if c.p.interpreter.Lenient {
+				return nil
+			}
+			// Calls of comment function result in no values, they are not counted.
+			left := 0
+			for _, arg := range n.args[i:] {
+				if c.defined["comment"] || c.dynamic || !isCommentCall(arg.value) {
+					left++
+				}
+			}
+			if left == 0 {
+				return nil
+			}
+			return c.error(pointer, ErrorArgumentCount{Function: n.name, Expected: fillInputsTo - 1, Received: fillInputsTo - 1 + left})
+		}
+		if v, ok := argValue(n.args[i].value, it); ok {
+			n.args[i].converted = v
+			continue
+		}
+		if isFunc(n.args[i].value) {
+			// Function can result in any number of values, the following arguments can't be matched to inputs.
+			return nil
+		}
+		// Other values are processed to values of the same type.
+		if i+1 >= fillInputsTo {
+			return c.error(n.args[i].pointer, fmt.Errorf("variadic argument type missmatch for function %s\ngot %v\nwant %v", n.name, reflect.TypeOf(n.args[i].value), it))
+		}
+		return c.error(n.args[i].pointer, fmt.Errorf("argument %d type missmatch for function %s\ngot %v\nwant %v", i+1, n.name, reflect.TypeOf(n.args[i].value), it))
+	}
+	if len(n.args) < fillInputsTo-1 {
+		return c.error(pointer, ErrorArgumentCount{Function: n.name, Expected: fillInputsTo - 1, Received: len(n.args), Variadic: t.IsVariadic()})
+	}
+	return nil
+}
+
+// Returns true if "in" is array or object function call.
+func isFunc(in interface{}) bool {
+	return isSliceFunc(in) || isMapFunc(in)
+}
@@ -0,0 +1,252 @@
+package funson
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		lenient bool
+		input   interface{}
+		want    interface{}
+		wantErr *EvalError
+	}{
+		{
+			name:  "leaf",
+			input: "a",
+			want:  "a",
+		},
+		{
+			name:  "nested calls",
+			input: map[string]interface{}{"a": []interface{}{float64(1), []interface{}{"!add", float64(1), []interface{}{"!mul", float64(2), float64(3)}}}},
+			want:  map[string]interface{}{"a": []interface{}{float64(1), float64(7)}},
+		},
+		{
+			name:  "object call",
+			input: []interface{}{map[string]interface{}{"!": "sub", "a": float64(5), "b": []interface{}{"!add", float64(1), float64(1)}}},
+			want:  []interface{}{float64(3)},
+		},
+		{
+			name:  "converted argument",
+			input: []interface{}{"!roundN", float64(1.256), float64(1)},
+			want:  float64(1.3),
+		},
+		{
+			name:  "defined function",
+			input: []interface{}{[]interface{}{"!def", "add", []interface{}{"x"}, []interface{}{"!env", "$x"}}, []interface{}{"!add", float64(1)}},
+			want:  []interface{}{float64(1)},
+		},
+		{
+			name:  "function results as arguments",
+			input: []interface{}{"!add", []interface{}{"!pair"}},
+			want:  float64(3),
+		},
+		{
+			name:    "unknown function",
+			input:   []interface{}{float64(1), []interface{}{"!nope"}},
+			wantErr: &EvalError{Pointer: "/1", Err: fmt.Errorf("no function found: nope")},
+		},
+		{
+			name:    "too many arguments",
+			input:   map[string]interface{}{"a": []interface{}{"!add", float64(1), float64(2), float64(3)}},
+			wantErr: &EvalError{Pointer: "/a", Err: ErrorArgumentCount{Function: "add", Expected: 2, Received: 3}},
+		},
+		{
+			name:  "trailing comment",
+			input: []interface{}{"!add", float64(1), float64(2), []interface{}{"!comment", "note"}},
+			want:  float64(3),
+		},
+		{
+			name:    "too many arguments after comment",
+			input:   []interface{}{"!add", float64(1), float64(2), []interface{}{"!comment"}, float64(3)},
+			wantErr: &EvalError{Pointer: "", Err: ErrorArgumentCount{Function: "add", Expected: 2, Received: 3}},
+		},
+		{
+			name:    "too many arguments lenient",
+			lenient: true,
+			input:   []interface{}{"!add", float64(1), float64(2), float64(3)},
+			want:    float64(3),
+		},
+		{
+			name:    "not enough arguments",
+			input:   []interface{}{"!add", float64(1)},
+			wantErr: &EvalError{Pointer: "", Err: ErrorArgumentCount{Function: "add", Expected: 2, Received: 1}},
+		},
+		{
+			name:    "argument type",
+			input:   []interface{}{"!add", float64(1), "a"},
+			wantErr: &EvalError{Pointer: "/2", Err: fmt.Errorf("argument 2 type missmatch for function add\ngot string\nwant float64")},
+		},
+		{
+			name:    "variadic argument type",
+			input:   []interface{}{"!sum", float64(1), []interface{}{}},
+			wantErr: &EvalError{Pointer: "/2", Err: fmt.Errorf("variadic argument type missmatch for function sum\ngot []interface {}\nwant float64")},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			in := New()
+			in.Lenient = tc.lenient
+			if err := in.AddFun("pair", func(_ *EnviromentNode) Result {
+				return Result{float64(1), float64(2)}
+			}); err != nil {
+				t.Fatalf("AddFun(pair) error = %v", err)
+			}
+			p, err := in.Compile(tc.input)
+			if tc.wantErr != nil {
+				var got *EvalError
+				if !errors.As(err, &got) {
+					t.Fatalf("Compile(%v) error = %#v, want *EvalError", tc.input, err)
+				}
+				if !reflect.DeepEqual(got, tc.wantErr) {
+					t.Errorf("Compile(%v) error = %#v, want %#v", tc.input, got, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Compile(%v) error = %v", tc.input, err)
+			}
+			for run := 0; run < 2; run++ {
+				got, err := p.Run()
+				if err != nil || !reflect.DeepEqual(got, tc.want) {
+					t.Errorf("Run() #%d = (%#v, %v), want (%#v, nil)", run, got, err, tc.want)
+				}
+			}
+			if got, err := in.Fun(tc.input); err != nil || !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Fun(%v) = (%#v, %v), want (%#v, nil)", tc.input, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestCompileAcceptsWhatFunRuns(t *testing.T) {
+	tests := []struct {
+		name  string
+		input interface{}
+	}{
+		{"comment unknown function", []interface{}{float64(1), []interface{}{"!comment", []interface{}{"!nope"}}}},
+		{"comment wrong arguments", []interface{}{float64(1), []interface{}{"!comment", []interface{}{"!add", float64(1)}}}},
+		{"object comment", []interface{}{float64(1), map[string]interface{}{"!": "comment", "a": []interface{}{"!nope"}}}},
+		{"if branch not taken", []interface{}{"!if", true, float64(1), []interface{}{"!add", float64(1)}}},
+		{"or not evaluated", []interface{}{"!?or", true, []interface{}{"!nope"}}},
+		{"function body not called", []interface{}{"!let", []interface{}{[]interface{}{"f", []interface{}{"!fn", []interface{}{}, []interface{}{"!add", "a", float64(1)}}}}, float64(1)}},
+		{"if branch taken", []interface{}{"!if", false, float64(1), []interface{}{"!add", float64(1)}}},
+		{"object form call", map[string]interface{}{"!": "if", "cond": true, "then": float64(1), "else": []interface{}{"!nope"}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			in := New()
+			want, wantErr := in.Fun(tc.input)
+			p, err := in.Compile(tc.input)
+			if err != nil {
+				t.Fatalf("Compile(%v) error = %v, Fun error = %v", tc.input, err, wantErr)
+			}
+			got, err := p.Run()
+			if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(err, wantErr) {
+				t.Errorf("Run() = (%#v, %v), Fun = (%#v, %v)", got, err, want, wantErr)
+			}
+		})
+	}
+}
+
+func TestProgramRunError(t *testing.T) {
+	input := []interface{}{
+		[]interface{}{"!def", "f", []interface{}{"x"}, []interface{}{"!div", []interface{}{"!env", "$x"}, float64(0)}},
+		[]interface{}{"!f", float64(1)},
+	}
+	p, err := Compile(input)
+	if err != nil {
+		t.Fatalf("Compile(%v) error = %v", input, err)
+	}
+	_, err = p.Run()
+	want := &EvalError{Pointer: "/0/3", Stack: []StackFrame{
+		{Function: "div", Pointer: "/0/3"},
+		{Function: "f", Pointer: "/1"},
+	}, Err: fmt.Errorf("division by 0")}
+	var got *EvalError
+	if !errors.As(err, &got) || !reflect.DeepEqual(got, want) {
+		t.Errorf("Run() error = %#v, want %#v", err, want)
+	}
+}
+
+func TestCompileSource(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "defs.fson"), []byte(`[ [ "!def", "double", [ "x" ], [ "!mul", [ "!env", "$x" ], 2 ] ] ]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "value.fson"), []byte(`[ "!add", 1, 2 ]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "main.fson")
+
+	input := []interface{}{
+		[]interface{}{"!import", "defs.fson"},
+		[]interface{}{"!double", []interface{}{"!include", "value.fson"}},
+	}
+	p, err := New().CompileSource(file, input)
+	if err != nil {
+		t.Fatalf("CompileSource(%v) error = %v", input, err)
+	}
+	want := []interface{}{float64(6)}
+	for run := 0; run < 2; run++ {
+		if got, err := p.Run(); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Run() #%d = (%#v, %v), want (%#v, nil)", run, got, err, want)
+		}
+	}
+
+	_, err = New().CompileSource(file, []interface{}{"!nope"})
+	want2 := &EvalError{File: file, Pointer: "", Err: fmt.Errorf("no function found: nope")}
+	var got *EvalError
+	if !errors.As(err, &got) || !reflect.DeepEqual(got, want2) {
+		t.Errorf("CompileSource() error = %#v, want %#v", err, want2)
+	}
+}
+
+// Program computing items of a receipt, without user interaction.
+func benchmarkProgram() interface{} {
+	items := make([]interface{}, 0, 20)
+	for i := 0; i < 20; i++ {
+		items = append(items, map[string]interface{}{
+			"name":  fmt.Sprintf("item %d", i),
+			"price": []interface{}{"!roundN", []interface{}{"!mul", float64(i), float64(1.21)}, float64(2)},
+			"count": []interface{}{"!add", float64(i), float64(1)},
+			"total": []interface{}{"!mul", []interface{}{"!mul", float64(i), float64(1.21)}, []interface{}{"!add", float64(i), float64(1)}},
+		})
+	}
+	return map[string]interface{}{
+		"items": items,
+		"sum":   []interface{}{"!sum", float64(1), float64(2), float64(3), []interface{}{"!sub", float64(10), float64(4)}},
+	}
+}
+
+func BenchmarkFun(b *testing.B) {
+	in := New()
+	program := benchmarkProgram()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := in.Fun(program); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProgramRun(b *testing.B) {
+	p, err := New().Compile(benchmarkProgram())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package funson
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Function call being evaluated.
+type StackFrame struct {
+	// Name of the called function.
+	Function string
+	// File containing the call, empty if the program was not read from file.
+	File string
+	// JSON Pointer of the call in the program.
+	Pointer string
+}
+
+func (f StackFrame) String() string {
+	if f.File == "" {
+		return fmt.Sprintf("%s at %q", f.Function, f.Pointer)
+	}
+	return fmt.Sprintf("%s at %s:%q", f.Function, f.File, f.Pointer)
+}
+
+// Error returned when processing of a program fails.
+// The underlying error "Err" can be examined with errors.Is and errors.As.
+type EvalError struct {
+	// File containing the failing node, empty if the program was not read from file.
+	File string
+	// JSON Pointer (RFC 6901) of the failing node in the program, empty string is the whole program.
+	Pointer string
+	// Function calls being evaluated when the error occurred, the innermost first.
+	Stack []StackFrame
+	Err   error
+}
+
+func (e *EvalError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("at %q: %s", e.Pointer, e.Err)
+	}
+	return fmt.Sprintf("at %s:%q: %s", e.File, e.Pointer, e.Err)
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// Returns multi-line description of the error with the failing node and the call stack.
+func (e *EvalError) Trace() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%s\n", e.Err)
+	if e.File == "" {
+		fmt.Fprintf(b, "  at %q\n", e.Pointer)
+	} else {
+		fmt.Fprintf(b, "  at %s:%q\n", e.File, e.Pointer)
+	}
+	for _, f := range e.Stack {
+		fmt.Fprintf(b, "  in %s\n", f)
+	}
+	return b.String()
+}
+
+// Returns "err" as *EvalError of node processed in "en" enviroment.
+// Errors which are already *EvalError are returned as they are, so the innermost failing node is reported.
+func (en *EnviromentNode) evalError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*EvalError); ok {
+		return err
+	}
+	return &EvalError{
+		File:    en.file(),
+		Pointer: en.pointer,
+		Stack:   en.callStack(),
+		Err:     err,
+	}
+}
+
+// Returns file of the program processed in enviroment, or empty string if there is none.
+func (en *EnviromentNode) file() string {
+	f, _ := en.FirstKey("file")
+	s, _ := f.(string)
+	return s
+}
+
+// Returns stack of function calls in enviroment, the innermost first.
+func (en *EnviromentNode) callStack() []StackFrame {
+	if len(en.stack) == 0 {
+		return nil
+	}
+	s := make([]StackFrame, len(en.stack))
+	for i, f := range en.stack {
+		s[len(s)-1-i] = f
+	}
+	return s
+}
+
+// Returns stack of enviroment with call of function "name" at enviroment node pushed on top.
+func (en *EnviromentNode) push(name string) []StackFrame {
+	return append(en.stack[:len(en.stack):len(en.stack)], StackFrame{
+		Function: name,
+		File:     en.file(),
+		Pointer:  en.pointer,
+	})
+}
+
+// Returns JSON Pointer of "token" in node with JSON Pointer "pointer".
+func pointerJoin(pointer string, token interface{}) string {
+	switch t := token.(type) {
+	case int:
+		return pointer + "/" + strconv.Itoa(t)
+	case string:
+		return pointer + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(t)
+	}
+	panic(fmt.Sprintf("invalid JSON Pointer token: %#v", token))
+}
+
+// Returns error for value "r" recovered from panic.
+func panicError(r interface{}) error {
+	if err, ok := r.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", r)
+}
@@ -0,0 +1,177 @@
+package funson
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestEvalError(t *testing.T) {
+	errTest := errors.New("test error")
+	in := New()
+	if err := in.AddFun("fail", func(_ *EnviromentNode) (string, error) {
+		return "", errTest
+	}); err != nil {
+		t.Fatalf("AddFun(fail) error = %v", err)
+	}
+	if err := in.AddFun("panic", func(_ *EnviromentNode) string {
+		panic(errTest)
+	}); err != nil {
+		t.Fatalf("AddFun(panic) error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		input interface{}
+		want  *EvalError
+	}{
+		{
+			name:  "root",
+			input: []interface{}{"!fail"},
+			want:  &EvalError{Pointer: "", Stack: []StackFrame{{Function: "fail"}}, Err: errTest},
+		},
+		{
+			name:  "panic",
+			input: []interface{}{float64(1), []interface{}{"!panic"}},
+			want:  &EvalError{Pointer: "/1", Stack: []StackFrame{{Function: "panic", Pointer: "/1"}}, Err: errTest},
+		},
+		{
+			name:  "nested argument",
+			input: []interface{}{float64(1), []interface{}{"!add", float64(1), []interface{}{"!fail"}}},
+			want: &EvalError{Pointer: "/1/2", Stack: []StackFrame{
+				{Function: "fail", Pointer: "/1/2"},
+				{Function: "add", Pointer: "/1"},
+			}, Err: errTest},
+		},
+		{
+			name:  "object key",
+			input: map[string]interface{}{"a/b~c": []interface{}{"!fail"}},
+			want:  &EvalError{Pointer: "/a~1b~0c", Stack: []StackFrame{{Function: "fail", Pointer: "/a~1b~0c"}}, Err: errTest},
+		},
+		{
+			name:  "named argument",
+			input: map[string]interface{}{"!": "sum", "numbers": []interface{}{float64(1), []interface{}{"!fail"}}},
+			want: &EvalError{Pointer: "/numbers/1", Stack: []StackFrame{
+				{Function: "fail", Pointer: "/numbers/1"},
+				{Function: "sum", Pointer: ""},
+			}, Err: errTest},
+		},
+		{
+			name: "defined function",
+			input: []interface{}{
+				[]interface{}{"!def", "f", []interface{}{"x"}, []interface{}{"!add", []interface{}{"!env", "$x"}, []interface{}{"!fail"}}},
+				[]interface{}{"!f", float64(1)},
+			},
+			want: &EvalError{Pointer: "/0/3/2", Stack: []StackFrame{
+				{Function: "fail", Pointer: "/0/3/2"},
+				{Function: "add", Pointer: "/0/3"},
+				{Function: "f", Pointer: "/1"},
+			}, Err: errTest},
+		},
+		{
+			name:  "function called by built-in",
+			input: []interface{}{"!map", []interface{}{"!fn", []interface{}{"x"}, []interface{}{"!fail"}}, []interface{}{float64(1)}},
+			want: &EvalError{Pointer: "/1/2", Stack: []StackFrame{
+				{Function: "fail", Pointer: "/1/2"},
+				{Function: "fn", Pointer: ""},
+				{Function: "map", Pointer: ""},
+			}, Err: errTest},
+		},
+		{
+			name:  "built-in processing argument",
+			input: []interface{}{"!let", map[string]interface{}{"a": float64(1)}, []interface{}{float64(1), []interface{}{"!fail"}}},
+			want: &EvalError{Pointer: "/2/1", Stack: []StackFrame{
+				{Function: "fail", Pointer: "/2/1"},
+				{Function: "let", Pointer: ""},
+			}, Err: errTest},
+		},
+		{
+			name:  "let binding",
+			input: []interface{}{"!let", []interface{}{[]interface{}{"a", []interface{}{"!fail"}}}, float64(1)},
+			want: &EvalError{Pointer: "/1/0/1", Stack: []StackFrame{
+				{Function: "fail", Pointer: "/1/0/1"},
+				{Function: "let", Pointer: ""},
+			}, Err: errTest},
+		},
+		{
+			name:  "pairsToMap value",
+			input: []interface{}{float64(1), []interface{}{"!pairsToMap", []interface{}{"a", float64(1)}, []interface{}{"b", []interface{}{"!div", float64(1), float64(0)}}}},
+			want: &EvalError{Pointer: "/1/2/1", Stack: []StackFrame{
+				{Function: "div", Pointer: "/1/2/1"},
+				{Function: "pairsToMap", Pointer: "/1"},
+			}, Err: fmt.Errorf("division by 0")},
+		},
+		{
+			name:  "built-in error",
+			input: []interface{}{"!div", float64(1), float64(0)},
+			want:  &EvalError{Pointer: "", Stack: []StackFrame{{Function: "div"}}, Err: fmt.Errorf("division by 0")},
+		},
+		{
+			name:  "missing argument",
+			input: []interface{}{[]interface{}{"!comment"}, map[string]interface{}{"!": "add", "a": float64(1)}},
+			want: &EvalError{Pointer: "/1", Stack: []StackFrame{
+				{Function: "add", Pointer: "/1"},
+			}, Err: ErrorMissingArgument{Function: "add", Name: "b"}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := in.Fun(tc.input)
+			var got *EvalError
+			if !errors.As(err, &got) {
+				t.Fatalf("Fun(%v) error = %#v, want *EvalError", tc.input, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Fun(%v) error = %#v, want %#v", tc.input, got, tc.want)
+			}
+			if tc.want.Err == errTest && !errors.Is(err, errTest) {
+				t.Errorf("errors.Is(%v, %v) = false, want true", err, errTest)
+			}
+		})
+	}
+}
+
+func TestEvalErrorTrace(t *testing.T) {
+	err := &EvalError{
+		File:    "main.fson",
+		Pointer: "/1/2",
+		Stack: []StackFrame{
+			{Function: "fail", File: "main.fson", Pointer: "/1/2"},
+			{Function: "add", Pointer: "/1"},
+		},
+		Err: fmt.Errorf("test error"),
+	}
+	want := "test error\n" +
+		"  at main.fson:\"/1/2\"\n" +
+		"  in fail at main.fson:\"/1/2\"\n" +
+		"  in add at \"/1\"\n"
+	if got := err.Trace(); got != want {
+		t.Errorf("Trace() = %q, want %q", got, want)
+	}
+	if got, want := err.Error(), "at main.fson:\"/1/2\": test error"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestPointerJoin(t *testing.T) {
+	tests := []struct {
+		pointer string
+		token   interface{}
+		want    string
+	}{
+		{"", 0, "/0"},
+		{"/a", 12, "/a/12"},
+		{"", "key", "/key"},
+		{"/0", "a/b", "/0/a~1b"},
+		{"", "~1", "/~01"},
+		{"", "", "/"},
+	}
+
+	for _, tc := range tests {
+		if got := pointerJoin(tc.pointer, tc.token); got != tc.want {
+			t.Errorf("pointerJoin(%q, %#v) = %q, want %q", tc.pointer, tc.token, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package funson
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Description of function available to programs, listed by Functions.
+type FunctionInfo struct {
+	Name string `json:"name"`
+	// Parameters of the function, without *EnviromentNode.
+	Params []ParamInfo `json:"params"`
+	// Description of parameters.
+	Input string `json:"input,omitempty"`
+	// Description of results.
+	Output string `json:"output,omitempty"`
+	// Description of what the function does.
+	Description string `json:"description,omitempty"`
+}
+
+// Parameter of function.
+type ParamInfo struct {
+	// Name binding argument of object form call, empty if the function has no parameter names.
+	Name string `json:"name,omitempty"`
+	// JSON type of argument: "number", "string", "boolean", "array", "object", "function", "time" or "any".
+	Type string `json:"type"`
+	// Variadic is true for the last parameter, which takes any number of arguments of the type.
+	Variadic bool `json:"variadic,omitempty"`
+}
+
+// Returns signature of the function, e.g. "sum(numbers ...number)".
+func (f FunctionInfo) String() string {
+	params := make([]string, len(f.Params))
+	for i, p := range f.Params {
+		t := p.Type
+		if p.Variadic {
+			t = "..." + t
+		}
+		if p.Name != "" {
+			t = p.Name + " " + t
+		}
+		params[i] = t
+	}
+	return f.Name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// Adds function "fun" like AddFun, described by "info" for Functions.
+// Names of info's parameters bind arguments of object form calls, types of parameters are derived from "fun" if empty.
+func AddFunWithInfo(name string, fun interface{}, info FunctionInfo) error {
+	return defaultInterpreter.AddFunWithInfo(name, fun, info)
+}
+
+// Adds custom function "fun" described by "info" to this interpreter, see AddFunWithInfo.
+func (i *Interpreter) AddFunWithInfo(name string, fun interface{}, info FunctionInfo) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return addFunWithInfo(i.functions, name, fun, info)
+}
+
+// Adds "fun" like addFun, with parameter names and description from "info".
+func addFunWithInfo(functions map[string]function, name string, fun interface{}, info FunctionInfo) error {
+	var params []string
+	for _, p := range info.Params {
+		if p.Name != "" {
+			params = make([]string, len(info.Params))
+			for i, p := range info.Params {
+				params[i] = p.Name
+			}
+			break
+		}
+	}
+	if len(params) == 0 && len(info.Params) > 0 {
+		if t := reflect.TypeOf(fun); t != nil && t.Kind() == reflect.Func && t.NumIn() != len(info.Params)+1 {
+			return ErrorParamsMismatch{Name: name, Params: make([]string, len(info.Params))}
+		}
+	}
+	if err := addFun(functions, name, fun, params...); err != nil {
+		return err
+	}
+	f := functions[name]
+	info.Name = name
+	f.info = info
+	functions[name] = f
+	return nil
+}
+
+// Returns descriptions of functions available to programs run by package level Fun, sorted by name.
+func Functions() []FunctionInfo {
+	return defaultInterpreter.Functions()
+}
+
+// Returns descriptions of functions available to programs run by this interpreter, sorted by name.
+// Functions defined by programs (def) are not listed.
+func (i *Interpreter) Functions() []FunctionInfo {
+	i.mu.RLock()
+	infos := make([]FunctionInfo, 0, len(i.functions))
+	for name, f := range i.functions {
+		infos = append(infos, f.describe(name))
+	}
+	i.mu.RUnlock()
+	sort.Slice(infos, func(a, b int) bool { return infos[a].Name < infos[b].Name })
+	return infos
+}
+
+// Returns description of function "f" registered as "name".
+func (f function) describe(name string) FunctionInfo {
+	info := f.info
+	info.Name = name
+	n := f.typ.NumIn() - 1
+	info.Params = make([]ParamInfo, n)
+	for i := range info.Params {
+		t := f.typ.In(i + 1)
+		p := ParamInfo{Variadic: f.typ.IsVariadic() && i == n-1}
+		if p.Variadic {
+			t = t.Elem()
+		}
+		p.Type = paramType(t)
+		if i < len(f.params) {
+			p.Name = f.params[i]
+		}
+		if i < len(f.info.Params) && f.info.Params[i].Type != "" {
+			p.Type = f.info.Params[i].Type
+		}
+		info.Params[i] = p
+	}
+	return info
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	timeValueType = reflect.TypeOf((*timeValue)(nil)).Elem()
+	lambdaType    = reflect.TypeOf(&Lambda{})
+)
+
+// Returns JSON type of arguments of Go type "t".
+func paramType(t reflect.Type) string {
+	switch t {
+	case timeType, timeValueType:
+		return "time"
+	case lambdaType:
+		return "function"
+	}
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Interface:
+		return "any"
+	}
+	return t.String()
+}
@@ -0,0 +1,86 @@
+package funson
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFunctions(t *testing.T) {
+	infos := New().Functions()
+	if len(infos) != len(builtins) {
+		t.Fatalf("len(Functions()) = %d, want %d", len(infos), len(builtins))
+	}
+	for i, info := range infos {
+		if i > 0 && infos[i-1].Name >= info.Name {
+			t.Errorf("Functions() not sorted: %s before %s", infos[i-1].Name, info.Name)
+		}
+		if info.Input == "" || info.Output == "" || info.Description == "" {
+			t.Errorf("function %s is not described: %#v", info.Name, info)
+		}
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"add", "add(a number, b number)"},
+		{"sum", "sum(numbers ...number)"},
+		{"if", "if(condition boolean, then any, else any)"},
+		{"map", "map(function function, list any)"},
+		{"def", "def(name string, params array, body any)"},
+		{"input", "input(object)"},
+		{"time.Now", "time.Now()"},
+		{"time.Diff", "time.Diff(from time, to time, unit string)"},
+	}
+	byName := make(map[string]FunctionInfo, len(infos))
+	for _, info := range infos {
+		byName[info.Name] = info
+	}
+	for _, tc := range tests {
+		if got := byName[tc.name].String(); got != tc.want {
+			t.Errorf("Functions()[%s] = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAddFunWithInfo(t *testing.T) {
+	in := New()
+	fun := func(_ *EnviromentNode, s string, n float64, rest ...interface{}) string { return s }
+	info := FunctionInfo{
+		Params:      []ParamInfo{{Name: "text"}, {Name: "count", Type: "integer"}, {Name: "rest"}},
+		Description: "Returns text.",
+	}
+	if err := in.AddFunWithInfo("echo", fun, info); err != nil {
+		t.Fatalf("AddFunWithInfo(echo) error = %v", err)
+	}
+	want := FunctionInfo{
+		Name: "echo",
+		Params: []ParamInfo{
+			{Name: "text", Type: "string"},
+			{Name: "count", Type: "integer"},
+			{Name: "rest", Type: "any", Variadic: true},
+		},
+		Description: "Returns text.",
+	}
+	var got FunctionInfo
+	for _, info := range in.Functions() {
+		if info.Name == "echo" {
+			got = info
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Functions()[echo] = %#v, want %#v", got, want)
+	}
+
+	input := map[string]interface{}{"!": "echo", "text": "a", "count": float64(1)}
+	if res, err := in.Fun(input); err != nil || res != "a" {
+		t.Errorf("Fun(%v) = (%v, %v), want (a, nil)", input, res, err)
+	}
+
+	if err := in.AddFunWithInfo("typed", fun, FunctionInfo{Params: []ParamInfo{{Type: "string"}}}); err == nil {
+		t.Errorf("AddFunWithInfo(typed) with wrong number of parameters error = nil, want error")
+	}
+	if err := in.AddFunWithInfo("echo", fun, info); !reflect.DeepEqual(err, ErrorDuplicateFunctionName{Name: "echo"}) {
+		t.Errorf("AddFunWithInfo(echo) again error = %v, want %v", err, ErrorDuplicateFunctionName{Name: "echo"})
+	}
+}
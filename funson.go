@@ -1,19 +1,168 @@
 package funson
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 )
 
 type Enviroment map[string]interface{}
 
 type EnviromentNode struct {
 	Enviroment
-	parent *EnviromentNode
+	parent      *EnviromentNode
+	interpreter *Interpreter
+	// JSON Pointer of the program node processed in enviroment.
+	pointer string
+	// Unprocessed arguments of function called in enviroment.
+	args []argNode
+	// Function calls being evaluated, the outermost first.
+	stack []StackFrame
+	// Program run the enviroment belongs to.
+	eval *evaluation
+	// Enviroment of one item of array or object, see itemChild.
+	item bool
+	// Array or object built so far, available to the item as "." or ":" enviroment.
+	dot   []interface{}
+	colon map[string]interface{}
+}
+
+// State of one program run, shared by all its enviroments.
+type evaluation struct {
+	ctx    context.Context
+	limits Limits
+	// Number of processed nodes, used atomically, shared with runs of parallel function items.
+	steps *int64
+	// Compiled program being run, nil if the program was not compiled.
+	program *Program
+	// Prompter of interactive functions, taken from interpreter when the run starts.
+	prompter Prompter
+	// Run of parallel function item, interactive functions can't be used.
+	parallel bool
+}
+
+// Program node passed as argument to function.
+type argNode struct {
+	value   interface{}
+	pointer string
+	// Value converted to type of function input ahead of time by Compile, if valid.
+	converted reflect.Value
 }
 
 func (en *EnviromentNode) Child(e Enviroment) *EnviromentNode {
-	return &EnviromentNode{e, en}
+	return &EnviromentNode{
+		Enviroment:  e,
+		parent:      en,
+		interpreter: en.interpreter,
+		pointer:     en.pointer,
+		args:        en.args,
+		stack:       en.stack,
+		eval:        en.eval,
+	}
+}
+
+// Returns context of the program run, functions should stop when it is done.
+// Returns background context if the enviroment is not part of a program run.
+func (en *EnviromentNode) Context() context.Context {
+	if en == nil || en.eval == nil {
+		return context.Background()
+	}
+	return en.eval.ctx
+}
+
+// Returns prompter of the program run, or of the interpreter if the enviroment is not part of a program run.
+func (en *EnviromentNode) prompter() Prompter {
+	if en != nil && en.eval != nil && en.eval.prompter != nil {
+		return en.eval.prompter
+	}
+	return en.Interpreter().prompter()
+}
+
+// Returns child enviroment for processing program node at JSON Pointer "pointer".
+func (en *EnviromentNode) node(pointer string, e Enviroment) *EnviromentNode {
+	n := en.Child(e)
+	n.pointer = pointer
+	n.args = nil
+	return n
+}
+
+// Returns child enviroment for processing one item of array built so far "dot", or one value of object built so far "colon", in enviroment.
+// The array or object enviroment is not changed by its items, names bound by def, var and import go to it through the item enviroment.
+// Item enviroment has no Enviroment map of its own.
+func (en *EnviromentNode) itemChild(dot []interface{}, colon map[string]interface{}) *EnviromentNode {
+	n := en.Child(nil)
+	n.item = true
+	n.dot = dot
+	n.colon = colon
+	return n
+}
+
+// Returns enviroment enclosing function call in enviroment, where def, var and import bind names.
+func (en *EnviromentNode) scope() *EnviromentNode {
+	scope := en.Parent()
+	for scope != nil && scope.item {
+		scope = scope.Parent()
+	}
+	if scope == nil {
+		return en
+	}
+	return scope
+}
+
+// Returns JSON Pointer of program node "in" processed in enviroment.
+// Unprocessed function arguments and nodes nested in them are at their own place in program, anything else is at the enviroment node.
+func (en *EnviromentNode) nodePointer(in interface{}) string {
+	for _, a := range en.args {
+		if p, ok := findNode(a.value, in); ok {
+			return a.pointer + p
+		}
+	}
+	return en.pointer
+}
+
+// Returns JSON Pointer of program node "in" relative to node "root", or false if "in" is not "root" nor nested in it.
+func findNode(root interface{}, in interface{}) (string, bool) {
+	if sameNode(root, in) {
+		return "", true
+	}
+	switch typed := root.(type) {
+	case []interface{}:
+		for i, v := range typed {
+			if p, ok := findNode(v, in); ok {
+				return pointerJoin("", i) + p, true
+			}
+		}
+	case map[string]interface{}:
+		for k, v := range typed {
+			if p, ok := findNode(v, in); ok {
+				return pointerJoin("", k) + p, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Returns true if "a" and "b" are the same array or object in program.
+func sameNode(a, b interface{}) bool {
+	switch at := a.(type) {
+	case []interface{}:
+		bt, ok := b.([]interface{})
+		return ok && len(at) > 0 && len(at) == len(bt) && &at[0] == &bt[0]
+	case map[string]interface{}:
+		bt, ok := b.(map[string]interface{})
+		return ok && reflect.ValueOf(at).Pointer() == reflect.ValueOf(bt).Pointer()
+	}
+	return false
+}
+
+// Returns interpreter running the enviroment, or default interpreter if none.
+func (en *EnviromentNode) Interpreter() *Interpreter {
+	if en == nil || en.interpreter == nil {
+		return defaultInterpreter
+	}
+	return en.interpreter
 }
 
 func (en *EnviromentNode) Parent() *EnviromentNode {
@@ -25,6 +174,14 @@ func (en *EnviromentNode) Parent() *EnviromentNode {
 
 func (en *EnviromentNode) FirstKey(k string) (interface{}, bool) {
 	for en != nil {
+		if en.item {
+			if k == "." && en.dot != nil {
+				return en.dot, true
+			}
+			if k == ":" && en.colon != nil {
+				return en.colon, true
+			}
+		}
 		if v, ok := en.Enviroment[k]; ok {
 			return v, true
 		}
@@ -33,23 +190,9 @@ func (en *EnviromentNode) FirstKey(k string) (interface{}, bool) {
 	return nil, false
 }
 
-func Fun(in interface{}) (res interface{}, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("no Fun: %s", r)
-		}
-	}()
-	env := &EnviromentNode{
-		Enviroment{},
-		nil,
-	}
-	res, err = env.Process(in)
-	return
-}
-
 func isSliceFunc(i interface{}) bool {
 	s, sok := i.([]interface{})
-	if !sok {
+	if !sok || len(s) == 0 {
 		return false
 	}
 	name, ok := s[0].(string)
@@ -64,17 +207,246 @@ func sliceFunc(sf []interface{}) (string, []interface{}) {
 
 }
 
+// Function defined in funson program, either named by def function or anonymous by fn function.
+// Lambdas are values, they can be stored in variables and passed as arguments to other functions.
+type Lambda struct {
+	params []string
+	body   interface{}
+	// JSON Pointer of the body in program.
+	pointer string
+	// Enviroment the function was defined in, the body is processed in its child.
+	env *EnviromentNode
+}
+
+type ErrorFunctionValue struct{}
+
+func (e ErrorFunctionValue) Error() string {
+	return "function value can't be a result"
+}
+
+// Returns ErrorFunctionValue, functions are not JSON values, so results holding them can't be written as JSON.
+func (l *Lambda) MarshalJSON() ([]byte, error) {
+	return nil, ErrorFunctionValue{}
+}
+
+// Returns function defined as "name" in enviroment or its parents.
+// Names beginning with "$" are looked up as variables holding a function.
+func (e *EnviromentNode) lambda(name string) (*Lambda, bool) {
+	key := "!" + name
+	if name[0] == '$' {
+		key = name
+	}
+	v, ok := e.FirstKey(key)
+	if !ok {
+		return nil, false
+	}
+	l, ok := v.(*Lambda)
+	return l, ok
+}
+
+// Processes arguments "args" and calls defined function "l" with them.
+func (e *EnviromentNode) callLambda(name string, l *Lambda, args ...argNode) (interface{}, error) {
+	values := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		ri, err := e.process(arg.value, arg.pointer)
+		if err != nil {
+			return nil, err
+		}
+		if r, ok := ri.(Result); ok {
+			values = append(values, r...)
+			continue
+		}
+		values = append(values, ri)
+	}
+	return l.call(e, e.stack, name, values)
+}
+
+// Calls function "l" with already processed arguments "args" from host function running in "en" enviroment.
+// Arguments are accessible in function body by "$" prefixed parameter names.
+func (l *Lambda) Call(en *EnviromentNode, args ...interface{}) (interface{}, error) {
+	return l.call(en, en.push("fn"), "fn", args)
+}
+
+// Calls function "l" as "name" from enviroment "caller" with function calls "stack".
+func (l *Lambda) call(caller *EnviromentNode, stack []StackFrame, name string, args []interface{}) (interface{}, error) {
+	if len(args) != len(l.params) {
+		return nil, ErrorArgumentCount{Function: name, Expected: len(l.params), Received: len(args)}
+	}
+
+	env := Enviroment{
+		"type": "lambda",
+		"name": name,
+	}
+	for i, p := range l.params {
+		env["$"+p] = args[i]
+	}
+	body := l.env.node(l.pointer, env)
+	body.stack = stack
+	body.eval = caller.eval
+	if err := body.checkDepth(); err != nil {
+		return nil, err
+	}
+	return body.Process(l.body)
+}
+
+func isMapFunc(i interface{}) bool {
+	m, ok := i.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = m["!"]
+	return ok
+}
+
+// Error of function called with wrong number of arguments.
+// Unprocessed arguments are counted as one argument each, even if they would result in more or no values.
+type ErrorArgumentCount struct {
+	Function           string
+	Expected, Received int
+	// Variadic function wants at least Expected arguments.
+	Variadic bool
+}
+
+func (e ErrorArgumentCount) Error() string {
+	if e.Variadic {
+		return fmt.Sprintf("function %s wants at least %d arguments, got %d", e.Function, e.Expected, e.Received)
+	}
+	return fmt.Sprintf("function %s wants %d arguments, got %d", e.Function, e.Expected, e.Received)
+}
+
+type ErrorUnknownArgument struct{ Function, Name string }
+
+func (e ErrorUnknownArgument) Error() string {
+	return fmt.Sprintf("unknown argument %q for function %s", e.Name, e.Function)
+}
+
+type ErrorMissingArgument struct{ Function, Name string }
+
+func (e ErrorMissingArgument) Error() string {
+	return fmt.Sprintf("missing argument %q for function %s", e.Name, e.Function)
+}
+
+type ErrorNoNamedParams struct{ Function string }
+
+func (e ErrorNoNamedParams) Error() string {
+	return fmt.Sprintf("function %s can not be called with named arguments, it has no parameter names", e.Function)
+}
+
+// Returns arguments of function "name" from object form call "in" ordered by function parameter names.
+// If the function has only one map[string]interface{} argument, the whole object (without "!" key) is the argument.
+// Value of the last parameter of variadic function can be an array, which elements are the variadic arguments.
+func (e *EnviromentNode) namedArgs(name string, in map[string]interface{}) ([]argNode, error) {
+	var params []string
+	variadic := false
+	if l, ok := e.lambda(name); ok {
+		params = l.params
+	} else {
+		f, ok := e.Interpreter().function(name)
+		if !ok {
+			return nil, fmt.Errorf("no function found: %s", name)
+		}
+		t := f.typ
+
+		if len(f.params) == 0 {
+			if t.NumIn() == 2 && !t.IsVariadic() && t.In(1) == reflect.TypeOf(map[string]interface{}{}) {
+				o := make(map[string]interface{}, len(in)-1)
+				for k, v := range in {
+					if k != "!" {
+						o[k] = v
+					}
+				}
+				return []argNode{{value: o, pointer: e.pointer}}, nil
+			}
+			if t.NumIn() > 1 {
+				return nil, ErrorNoNamedParams{Function: name}
+			}
+		}
+		params, variadic = f.params, t.IsVariadic()
+	}
+
+	known := make(map[string]bool, len(params))
+	args := make([]argNode, 0, len(params))
+	for i, p := range params {
+		known[p] = true
+		v, ok := in[p]
+		variadicParam := variadic && i == len(params)-1
+		if !ok {
+			if variadicParam {
+				continue
+			}
+			return nil, ErrorMissingArgument{Function: name, Name: p}
+		}
+		pointer := pointerJoin(e.pointer, p)
+		if va, ok := v.([]interface{}); ok && variadicParam && !isSliceFunc(va) {
+			for j, vi := range va {
+				args = append(args, argNode{value: vi, pointer: pointerJoin(pointer, j)})
+			}
+			continue
+		}
+		args = append(args, argNode{value: v, pointer: pointer})
+	}
+	for k := range in {
+		if k != "!" && !known[k] {
+			return nil, ErrorUnknownArgument{Function: name, Name: k}
+		}
+	}
+	return args, nil
+}
+
+// Calls function named by "!" key of object "in" with the other keys as named arguments.
+func (e *EnviromentNode) processMapFunc(in map[string]interface{}) (interface{}, error) {
+	nameUntyped, err := e.process(in["!"], pointerJoin(e.pointer, "!"))
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := nameUntyped.(Result); ok && len(r) == 1 {
+		nameUntyped = r[0]
+	}
+	name, ok := nameUntyped.(string)
+	if name == "" || !ok {
+		return nil, fmt.Errorf("function name is empty or not string: %#v", nameUntyped)
+	}
+
+	e.Enviroment["name"] = name
+	e.stack = e.push(name)
+	if err := e.checkDepth(); err != nil {
+		return nil, err
+	}
+	args, err := e.namedArgs(name, in)
+	if err != nil {
+		return nil, err
+	}
+	return e.processFunc(name, args)
+}
+
 func (e *EnviromentNode) processSliceFunc(name string, args ...interface{}) (interface{}, error) {
-	//log.Printf("\nproccessSliceFunc: %s: %v\n", name, args)
-	//log.Printf("processSliceFunc: e: %#v\n", e.Enviroment)
-	//defer log.Printf("processSliceFunc: end\n\n")
+	nodes := make([]argNode, len(args))
+	for i, arg := range args {
+		nodes[i] = argNode{value: arg, pointer: pointerJoin(e.pointer, i+1)}
+	}
+	return e.processFunc(name, nodes)
+}
+
+// Calls function "name" with program nodes "args" as arguments.
+func (e *EnviromentNode) processFunc(name string, args []argNode) (interface{}, error) {
+	//log.Printf("\nproccessFunc: %s: %v\n", name, args)
+	//log.Printf("processFunc: e: %#v\n", e.Enviroment)
+	//defer log.Printf("processFunc: end\n\n")
+
+	e.args = args
+	if l, ok := e.lambda(name); ok {
+		return e.callLambda(name, l, args...)
+	}
 
-	function, ok := functions[name]
+	f, ok := e.Interpreter().function(name)
 	if !ok {
 		return nil, fmt.Errorf("no function found: %s", name)
 	}
-
-	t := reflect.TypeOf(function)
+	q := &argQueue{e: e, args: args}
+	if f.adapter != nil {
+		return callAdapter(f.adapter, name, q)
+	}
+	t := f.typ
 
 	inputs := make([]reflect.Value, t.NumIn())
 	inputs[0] = reflect.ValueOf(e)
@@ -82,101 +454,54 @@ func (e *EnviromentNode) processSliceFunc(name string, args ...interface{}) (int
 	if t.IsVariadic() {
 		fillInputsTo--
 	}
-	processedArgs := make([]interface{}, 0)
 	for i := 1; i < fillInputsTo; i++ {
-		var inArg interface{}
-		isProcessed := false
-		if len(processedArgs) > 0 {
-			inArg = processedArgs[0]
-			processedArgs = processedArgs[1:]
-			isProcessed = true
-
-		} else if len(args) > 0 {
-			inArg = args[0]
-			args = args[1:]
-
-		} else {
-			return nil, fmt.Errorf("not enough arguments for function %s: %v", name, inputs)
-		}
 		it := t.In(i)
-		if it == reflect.TypeOf(inArg) || reflect.TypeOf(inArg).ConvertibleTo(it) {
-			inputs[i] = reflect.ValueOf(inArg)
-			continue
-		}
-		if isProcessed {
-			return nil, fmt.Errorf("argument %d type missmatch for function %s\ngot %v\nwant %v", i, name, reflect.TypeOf(inArg), it)
-		}
-		ri, err := e.Process(inArg)
+		v, ok, err := q.next(it)
 		if err != nil {
-			return nil, fmt.Errorf("error processing %d argument for function %s: %s", i, name, err)
-		}
-		if r, ok := ri.(Result); ok {
-			if len(r) == 0 {
-				i--
-				continue
+			if m, ok := err.(argTypeMismatch); ok {
+				return nil, fmt.Errorf("argument %d type missmatch for function %s\ngot %v\nwant %v", i, name, m.got, it)
 			}
-			processedArgs = append(processedArgs, r[1:]...)
-			ri = r[0]
+			return nil, err
 		}
-		if it == reflect.TypeOf(ri) || reflect.TypeOf(ri).ConvertibleTo(it) {
-			inputs[i] = reflect.ValueOf(ri)
-			continue
+		if !ok {
+			return nil, ErrorArgumentCount{Function: name, Expected: fillInputsTo - 1, Received: i - 1, Variadic: t.IsVariadic()}
 		}
-		return nil, fmt.Errorf("argument %d type missmatch for function %s\ngot %v\nwant %v", i, name, reflect.TypeOf(ri), it)
+		inputs[i] = v
 	}
 
 	if t.IsVariadic() {
 		i := len(inputs) - 1
 		vat := t.In(i)
 		vaet := vat.Elem()
-		inv := reflect.MakeSlice(vat, 0, len(processedArgs)+len(args))
-		for len(processedArgs)+len(args) > 0 {
-			var inArg interface{}
-			isProcessed := false
-			if len(processedArgs) > 0 {
-				inArg = processedArgs[0]
-				processedArgs = processedArgs[1:]
-				isProcessed = true
-			} else if len(args) > 0 {
-				inArg = args[0]
-				args = args[1:]
-			} else {
-				break
-			}
-			if vaet == reflect.TypeOf(inArg) || reflect.TypeOf(inArg).ConvertibleTo(vaet) {
-				inv = reflect.Append(inv, reflect.ValueOf(inArg))
-				continue
-			}
-			if isProcessed {
-				return nil, fmt.Errorf("variadic argument type missmatch for function %s\ngot %v\nwant %v", name, reflect.TypeOf(inArg), vaet)
-			}
-
-			ri, err := e.Process(inArg)
+		inv := reflect.MakeSlice(vat, 0, q.left())
+		for {
+			v, ok, err := q.next(vaet)
 			if err != nil {
-				return nil, fmt.Errorf("error processing variadic argument for function %s: %s", name, err)
-			}
-			if r, ok := ri.(Result); ok {
-				if len(r) == 0 {
-					continue
+				if m, ok := err.(argTypeMismatch); ok {
+					return nil, fmt.Errorf("variadic argument type missmatch for function %s\ngot %v\nwant %v", name, m.got, vaet)
 				}
-				processedArgs = append(processedArgs, r[1:]...)
-				ri = r[0]
+				return nil, err
 			}
-			if vaet == reflect.TypeOf(ri) || reflect.TypeOf(ri).ConvertibleTo(vaet) {
-				inv = reflect.Append(inv, reflect.ValueOf(ri))
-				continue
+			if !ok {
+				break
 			}
-			return nil, fmt.Errorf("variadic argument type missmatch for function %s\ngot %v\nwant %v", name, reflect.TypeOf(ri), vaet)
+			inv = reflect.Append(inv, v)
 		}
 		inputs[i] = inv
 	}
-	//TODO If function is not variadic, check if here are any leftover arguments and return error if any.
+	if err := q.leftover(name, t.NumIn()-1); err != nil {
+		return nil, err
+	}
 
-	var resVal []reflect.Value
-	if t.IsVariadic() {
-		resVal = reflect.ValueOf(function).CallSlice(inputs)
-	} else {
-		resVal = reflect.ValueOf(function).Call(inputs)
+	resVal, err := callFunction(f.value, inputs, t.IsVariadic())
+	if err != nil {
+		return nil, err
+	}
+	if returnsError(t) {
+		if err, _ := resVal[len(resVal)-1].Interface().(error); err != nil {
+			return nil, err
+		}
+		resVal = resVal[:len(resVal)-1]
 	}
 	res := make(Result, 0, len(resVal))
 	for i := range resVal {
@@ -190,6 +515,139 @@ func (e *EnviromentNode) processSliceFunc(name string, args ...interface{}) (int
 	return res, nil
 }
 
+// Arguments of function call, which are taken one by one as function inputs.
+type argQueue struct {
+	e    *EnviromentNode
+	args []argNode
+	// Values of already processed argument, which resulted in multiple values.
+	processed []interface{}
+}
+
+// Error of argument value, which is not of wanted type.
+type argTypeMismatch struct{ got reflect.Type }
+
+func (e argTypeMismatch) Error() string {
+	return fmt.Sprintf("argument type missmatch: %v", e.got)
+}
+
+// Returns next argument as value of type "t", or false if there are no arguments left.
+// Argument is processed only if it is not of type "t" already, multiple values of processed argument are the next arguments.
+func (q *argQueue) next(t reflect.Type) (reflect.Value, bool, error) {
+	for {
+		if len(q.processed) > 0 {
+			v := q.processed[0]
+			q.processed = q.processed[1:]
+			rv, ok := argValue(v, t)
+			if !ok {
+				return rv, true, argTypeMismatch{reflect.TypeOf(v)}
+			}
+			return rv, true, nil
+		}
+		if len(q.args) == 0 {
+			return reflect.Value{}, false, nil
+		}
+		arg := q.args[0]
+		q.args = q.args[1:]
+		if arg.converted.IsValid() && arg.converted.Type() == t {
+			return arg.converted, true, nil
+		}
+		if rv, ok := argValue(arg.value, t); ok {
+			return rv, true, nil
+		}
+		ri, err := q.e.process(arg.value, arg.pointer)
+		if err != nil {
+			return reflect.Value{}, true, err
+		}
+		if r, ok := ri.(Result); ok {
+			if len(r) == 0 {
+				continue
+			}
+			q.processed = append(q.processed, r[1:]...)
+			ri = r[0]
+		}
+		rv, ok := argValue(ri, t)
+		if !ok {
+			return rv, true, argTypeMismatch{reflect.TypeOf(ri)}
+		}
+		return rv, true, nil
+	}
+}
+
+// Returns number of arguments left, unprocessed arguments count as one.
+func (q *argQueue) left() int {
+	return len(q.processed) + len(q.args)
+}
+
+// Returns error if there are arguments left for function "name", which takes "n" arguments, unless the interpreter is lenient.
+// Arguments left are not processed, so functions with side effects (e.g. input, print) are not run. Calls of comment function are not counted, they result in no values.
+func (q *argQueue) leftover(name string, n int) error {
+	if q.e.Interpreter().Lenient {
+		return nil
+	}
+	left := len(q.processed)
+	_, commentDefined := q.e.lambda("comment")
+	for _, arg := range q.args {
+		if !commentDefined && isCommentCall(arg.value) {
+			continue
+		}
+		left++
+	}
+	q.args = nil
+	if left > 0 {
+		return ErrorArgumentCount{Function: name, Expected: n, Received: n + left}
+	}
+	return nil
+}
+
+// Returns true if "in" is array or object call of function named comment.
+func isCommentCall(in interface{}) bool {
+	if m, ok := in.(map[string]interface{}); ok {
+		return isMapFunc(m) && m["!"] == "comment"
+	}
+	s, _ := in.([]interface{})
+	name, _ := sliceFunc(s)
+	return name == "comment"
+}
+
+// Returns "v" as value of type "t", or false if it is not assignable nor convertible to "t".
+func argValue(v interface{}, t reflect.Type) (reflect.Value, bool) {
+	if v == nil {
+		if t.Kind() == reflect.Interface {
+			return reflect.Zero(t), true
+		}
+		return reflect.Value{}, false
+	}
+	vt := reflect.TypeOf(v)
+	if vt == t {
+		return reflect.ValueOf(v), true
+	}
+	if vt.ConvertibleTo(t) {
+		return reflect.ValueOf(v).Convert(t), true
+	}
+	return reflect.Value{}, false
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Returns true if the last result of function type "t" is error.
+func returnsError(t reflect.Type) bool {
+	return t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+}
+
+// Calls function "f" with "inputs" and returns its outputs, or error if the function panics.
+// Recovering is the last resort, functions should report failures with error result.
+func callFunction(f reflect.Value, inputs []reflect.Value, variadic bool) (out []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = panicError(r)
+		}
+	}()
+	if variadic {
+		return f.CallSlice(inputs), nil
+	}
+	return f.Call(inputs), nil
+}
+
 func (e *EnviromentNode) processSlice(in []interface{}) (interface{}, error) {
 	//log.Printf("\nproccessSlice: i: %v\n", in)
 	//log.Printf("processSlice: e: %#v\n", e.Enviroment)
@@ -199,15 +657,30 @@ func (e *EnviromentNode) processSlice(in []interface{}) (interface{}, error) {
 		return []interface{}{}, nil
 	}
 
+	var pointers []string
+	if c := e.compiled(in); c != nil {
+		pointers = c.pointers
+	}
 	out := make([]interface{}, 0, len(in))
 	for i, v := range in {
 		//log.Printf("\tout: %#v\n", out)
 		//log.Printf("\tprocessing %d item %v\n", i, v)
 
-		e.Enviroment["."] = out
-		ri, err := e.Process(v)
+		if s, ok := v.(string); ok && i == 0 && strings.HasPrefix(s, "!!") {
+			//log.Printf("processSlice: first string in array begins with \"!!\": %s", s)
+			out = append(out, s[1:])
+			continue
+		}
+		pointer := ""
+		if pointers != nil {
+			pointer = pointers[i]
+		} else {
+			pointer = pointerJoin(e.pointer, i)
+		}
+		// The array built so far is available to the item as "." enviroment.
+		ri, err := e.itemChild(out, nil).process(v, pointer)
 		if err != nil {
-			return out, fmt.Errorf("processing %d item error: %s", i, err)
+			return out, err
 		}
 		//log.Printf("\tcomputing result: %#v\n", ri)
 		if r, ok := ri.(Result); ok {
@@ -220,84 +693,135 @@ func (e *EnviromentNode) processSlice(in []interface{}) (interface{}, error) {
 	return out, nil
 }
 
+func (e *EnviromentNode) processMap(in map[string]interface{}) (interface{}, error) {
+	out := make(map[string]interface{}, len(in))
+	if len(in) == 0 {
+		return out, nil
+	}
+
+	// Keys are processed in sorted order, so the partially built object in ":" is predictable.
+	var keys, pointers []string
+	if c := e.compiled(in); c != nil {
+		keys, pointers = c.keys, c.pointers
+	} else {
+		keys = make([]string, 0, len(in))
+		for k := range in {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+	}
+
+	for i, k := range keys {
+		key := k
+		if strings.HasPrefix(k, "!!") {
+			key = k[1:]
+		}
+		pointer := ""
+		if pointers != nil {
+			pointer = pointers[i]
+		} else {
+			pointer = pointerJoin(e.pointer, k)
+		}
+		// The object built so far is available to the value as ":" enviroment.
+		ri, err := e.itemChild(nil, out).process(in[k], pointer)
+		if err != nil {
+			return out, err
+		}
+		if r, ok := ri.(Result); ok {
+			switch len(r) {
+			case 0:
+				ri = nil
+			case 1:
+				ri = r[0]
+			default:
+				return out, e.node(pointer, nil).evalError(fmt.Errorf("multiple values returned for key %q: %#v", k, r))
+			}
+		}
+		out[key] = ri
+	}
+	return out, nil
+}
+
+// Returns function result "res" as is, or unwrapped from Result if there is no parent enviroment to pass the Result to.
+func (e *EnviromentNode) functionResult(res interface{}, err error) (interface{}, error) {
+	if err != nil {
+		return res, err
+	}
+	fr, ok := res.(Result)
+	if !ok {
+		return res, nil
+	}
+	if e.Parent() == nil {
+		if len(fr) == 0 {
+			return nil, nil
+		}
+		if len(fr) > 1 {
+			//TODO structured error
+			return fr, fmt.Errorf("multiple values retured: %#v", fr)
+		}
+		return fr[0], nil
+	}
+	return fr, nil
+}
+
+// Processes program node "in" and returns its result.
+// Errors are returned as *EvalError.
 func (e *EnviromentNode) Process(in interface{}) (interface{}, error) {
+	return e.process(in, e.nodePointer(in))
+}
+
+// Processes program node "in" at JSON Pointer "pointer".
+func (e *EnviromentNode) process(in interface{}, pointer string) (interface{}, error) {
+	if err := e.step(); err != nil {
+		return nil, e.node(pointer, nil).evalError(err)
+	}
 	//log.Printf("process: type: %s", reflect.TypeOf(in))
 	switch typedIn := in.(type) {
 	case []interface{}:
-		var res interface{}
-		var err error
-
-		if isSliceFunc(typedIn) {
-			name, args := sliceFunc(typedIn)
-			res, err = e.Child(Enviroment{
-				"type": "sliceFunc",
-				"name": name,
-			}).processSliceFunc(name, args...)
-		} else {
-			res, err = e.Child(Enviroment{
+		c := e.compiled(typedIn)
+		if c == nil && !isSliceFunc(typedIn) || c != nil && c.name == "" {
+			n := e.node(pointer, Enviroment{
 				"type": "slice",
-			}).processSlice(typedIn)
+			})
+			res, err := n.processSlice(typedIn)
+			return res, n.evalError(err)
 		}
-		if err != nil {
-			return res, err
+		var name string
+		var args []interface{}
+		if c != nil {
+			name = c.name
+		} else {
+			name, args = sliceFunc(typedIn)
 		}
-		fr, ok := res.(Result)
-		if !ok {
-			return res, nil
+		n := e.node(pointer, Enviroment{
+			"type": "sliceFunc",
+			"name": name,
+		})
+		n.stack = n.push(name)
+		if err := n.checkDepth(); err != nil {
+			return nil, n.evalError(err)
 		}
-		if e.Parent() == nil {
-			if len(fr) == 0 {
-				return nil, nil
-			}
-			if len(fr) > 1 {
-				//TODO structured error
-				return fr, fmt.Errorf("multiple values retured: %#v", fr)
-			}
-			return fr[0], nil
+		var res interface{}
+		var err error
+		if c != nil {
+			res, err = e.functionResult(n.processFunc(name, c.args))
+		} else {
+			res, err = e.functionResult(n.processSliceFunc(name, args...))
 		}
-		return fr, nil
+		return res, n.evalError(err)
 	case map[string]interface{}:
-		//return runMap(e.Copy(), typedIn)
-	case string:
-		//log.Printf("%s, %v\n", typedIn, e.Enviroment)
-		if t, ok := e.Enviroment["type"].(string); ok && t == "slice" {
-			if o, ok := e.Enviroment["."].([]interface{}); ok && len(o) == 0 {
-				if len(typedIn) >= 2 && typedIn[0] == '!' && typedIn[1] == '!' {
-					//log.Printf("process: first string in array begins with \"!!\": %s", typedIn)
-					return typedIn[1:], nil
-				}
-			}
+		if !isMapFunc(typedIn) {
+			n := e.node(pointer, Enviroment{
+				"type": "map",
+			})
+			res, err := n.processMap(typedIn)
+			return res, n.evalError(err)
 		}
+		n := e.node(pointer, Enviroment{
+			"type": "mapFunc",
+		})
+		res, err := e.functionResult(n.processMapFunc(typedIn))
+		return res, n.evalError(err)
 	}
 	return in, nil
 }
-
-//func runMap(env Enviroment, in map[string]interface{}) (interface{}, error) {
-//	if len(in) == 0 {
-//		return map[string]interface{}{}, nil
-//	}
-//	if fnameUntyped, ok := in["!"]; ok == true {
-//		fnameUntyped, err := run(env, fnameUntyped)
-//		if err != nil {
-//			//TODO structured error
-//			return nil, fmt.Errorf("unable to resolve function name: %s", err)
-//		}
-//		fname, ok := fnameUntyped.(string)
-//		if fname == "" || !ok {
-//			//TODO structured error
-//			return nil, fmt.Errorf("function name is empty or not string: %#v", fname)
-//		}
-//
-//		return "implement map function: " + fname, nil
-//	}
-//	out := map[string]interface{}{}
-//	for k, v := range in {
-//		value, err := run(env, v)
-//		if err != nil {
-//			//TODO structured error
-//			return nil, fmt.Errorf("unable to resolve value for key \"%s\": %s", k, err)
-//		}
-//		out[k] = value
-//	}
-//	return out, nil
-//}
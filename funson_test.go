@@ -1,10 +1,16 @@
 package funson
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestFun(t *testing.T) {
@@ -36,7 +42,71 @@ func TestFun(t *testing.T) {
 			name:    "variadic multiple results",
 			input:   []interface{}{"!not", true, false},
 			want:    Result{false, true},
-			wantErr: fmt.Errorf("multiple values retured: %#v", Result{false, true}),
+			wantErr: &EvalError{Stack: []StackFrame{{Function: "not"}}, Err: fmt.Errorf("multiple values retured: %#v", Result{false, true})},
+		},
+		{
+			name: "object values",
+			input: map[string]interface{}{
+				"a": []interface{}{"!add", float64(1), float64(2)},
+				"b": []interface{}{float64(1), []interface{}{"!comment"}, float64(2)},
+				"c": "leaf",
+			},
+			want: map[string]interface{}{
+				"a": float64(3),
+				"b": []interface{}{float64(1), float64(2)},
+				"c": "leaf",
+			},
+			wantErr: nil,
+		},
+		{
+			name: "object partial environment",
+			input: map[string]interface{}{
+				"a": float64(1),
+				"b": []interface{}{"!add", []interface{}{"!env", ":a"}, float64(2)},
+				"c": map[string]interface{}{"x": "nested", "y": []interface{}{"!env", ":x"}},
+			},
+			want: map[string]interface{}{
+				"a": float64(1),
+				"b": float64(3),
+				"c": map[string]interface{}{"x": "nested", "y": "nested"},
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "trailing comment",
+			input:   []interface{}{"!add", float64(1), float64(2), []interface{}{"!comment", "note"}, map[string]interface{}{"!": "comment"}},
+			want:    float64(3),
+			wantErr: nil,
+		},
+		{
+			name:    "object value results collapsed",
+			input:   map[string]interface{}{"none": []interface{}{"!comment"}, "one": []interface{}{"!not", true}},
+			want:    map[string]interface{}{"none": nil, "one": false},
+			wantErr: nil,
+		},
+		{
+			name:    "object value multiple results",
+			input:   map[string]interface{}{"a": float64(1), "b": []interface{}{"!not", true, false}},
+			want:    map[string]interface{}{"a": float64(1)},
+			wantErr: &EvalError{Pointer: "/b", Err: fmt.Errorf("multiple values returned for key %q: %#v", "b", Result{false, true})},
+		},
+		{
+			name:    "array partial environment",
+			input:   []interface{}{float64(1), []interface{}{"!add", []interface{}{"!item", float64(0), []interface{}{"!env", "."}}, float64(1)}, []interface{}{"!env", "."}},
+			want:    []interface{}{float64(1), float64(2), []interface{}{float64(1), float64(2)}},
+			wantErr: nil,
+		},
+		{
+			name:    "array escaped function name",
+			input:   []interface{}{"!!add", "!!x"},
+			want:    []interface{}{"!add", "!!x"},
+			wantErr: nil,
+		},
+		{
+			name:    "object escaped function key",
+			input:   map[string]interface{}{"!!": "add", "!!x": float64(1)},
+			want:    map[string]interface{}{"!": "add", "!x": float64(1)},
+			wantErr: nil,
 		},
 	}
 
@@ -50,6 +120,22 @@ func TestFun(t *testing.T) {
 	}
 }
 
+func TestLeftoverNotProcessed(t *testing.T) {
+	p := &scriptedPrompter{answers: []string{"1"}}
+	stderr := &bytes.Buffer{}
+	in := New()
+	in.Prompter = p
+	in.Stderr = stderr
+	input := []interface{}{"!add", float64(1), float64(2), []interface{}{"!input", map[string]interface{}{"question": "x"}}, []interface{}{"!print", "y"}}
+	_, err := in.Fun(input)
+	if want := (ErrorArgumentCount{Function: "add", Expected: 2, Received: 4}); !errors.As(err, &ErrorArgumentCount{}) || errors.Unwrap(err) != want {
+		t.Errorf("Fun(%v) error = %v, want %v", input, err, want)
+	}
+	if len(p.questions) > 0 || stderr.Len() > 0 {
+		t.Errorf("leftover arguments processed, questions = %v, stderr = %q", p.questions, stderr.String())
+	}
+}
+
 func TestIsSliceFunc(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -143,24 +229,28 @@ func TestSliceFunc(t *testing.T) {
 }
 
 func TestProcessSliceFunc(t *testing.T) {
-	origFunctions := copyMap(functions)
-	defer func() { functions = origFunctions }()
+	in := &Interpreter{functions: map[string]function{}}
 
-	functions = map[string]interface{}{}
-
-	if err := AddFun("addTest", func(_ *EnviromentNode, a, b float64) float64 {
+	if err := in.AddFun("addTest", func(_ *EnviromentNode, a, b float64) float64 {
 		return a + b
 	}); err != nil {
 		t.Fatalf("AddFun(addTest) error = %v", err)
 	}
 
-	if err := AddFun("concatTest", func(_ *EnviromentNode, strs ...string) string {
+	if err := in.AddFun("concatTest", func(_ *EnviromentNode, strs ...string) string {
 		return strings.Join(strs, "")
 	}); err != nil {
 		t.Fatalf("AddFun(concatTest) error = %v", err)
 	}
 
-	en := &EnviromentNode{Enviroment{}, nil}
+	if err := in.AddFun("tripleTest", func(_ *EnviromentNode) Result {
+		return Result{float64(1), float64(2), float64(3)}
+	}); err != nil {
+		t.Fatalf("AddFun(tripleTest) error = %v", err)
+	}
+
+	// Child of root enviroment, so multiple results of arguments are not collapsed.
+	en := (&EnviromentNode{Enviroment: Enviroment{}, interpreter: in}).Child(Enviroment{})
 
 	tests := []struct {
 		name    string
@@ -171,6 +261,10 @@ func TestProcessSliceFunc(t *testing.T) {
 	}{
 		{"add numbers", "addTest", []interface{}{float64(1), float64(2)}, Result{float64(3)}, nil},
 		{"concat", "concatTest", []interface{}{"a", "b", "c"}, Result{"abc"}, nil},
+		{"leftover arguments", "addTest", []interface{}{float64(1), float64(2), float64(3)}, nil, ErrorArgumentCount{Function: "addTest", Expected: 2, Received: 3}},
+		{"leftover result values", "addTest", []interface{}{[]interface{}{"!tripleTest"}}, nil, ErrorArgumentCount{Function: "addTest", Expected: 2, Received: 3}},
+		{"leftover function call", "addTest", []interface{}{float64(1), float64(2), []interface{}{"!tripleTest"}}, nil, ErrorArgumentCount{Function: "addTest", Expected: 2, Received: 3}},
+		{"not enough arguments", "addTest", []interface{}{float64(1)}, nil, ErrorArgumentCount{Function: "addTest", Expected: 2, Received: 1}},
 		{"argument type mismatch", "addTest", []interface{}{"foo", float64(2)}, nil, fmt.Errorf("argument %d type missmatch for function %s\ngot %v\nwant %v", 1, "addTest", reflect.TypeOf("foo"), reflect.TypeOf(float64(0)))},
 	}
 
@@ -183,3 +277,132 @@ func TestProcessSliceFunc(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessMapFunc(t *testing.T) {
+	in := New()
+	in.Stdout = ioutil.Discard
+
+	tests := []struct {
+		name    string
+		stdin   string
+		input   interface{}
+		want    interface{}
+		wantErr error
+	}{
+		{
+			name:  "named arguments",
+			input: map[string]interface{}{"!": "sub", "b": float64(1), "a": float64(3)},
+			want:  float64(2),
+		},
+		{
+			name:  "function name from function",
+			input: map[string]interface{}{"!": []interface{}{"!concat", "a", "dd"}, "a": float64(1), "b": []interface{}{"!add", float64(1), float64(1)}},
+			want:  float64(3),
+		},
+		{
+			name:  "variadic array",
+			input: map[string]interface{}{"!": "sum", "numbers": []interface{}{float64(1), float64(2), []interface{}{"!add", float64(1), float64(2)}}},
+			want:  float64(6),
+		},
+		{
+			name:  "variadic single value",
+			input: map[string]interface{}{"!": "sum", "numbers": []interface{}{"!add", float64(1), float64(2)}},
+			want:  float64(3),
+		},
+		{
+			name:  "variadic omitted",
+			input: map[string]interface{}{"!": "sum"},
+			want:  float64(0),
+		},
+		{
+			name:  "no parameters",
+			input: []interface{}{"!time.Format", map[string]interface{}{"!": "time.Now"}, "2006"},
+			want:  time.Now().Format("2006"),
+		},
+		{
+			name:  "options object",
+			stdin: "2.5\n",
+			input: map[string]interface{}{"!": "input", "type": "float", "question": "Enter amount"},
+			want:  float64(2.5),
+		},
+		{
+			name:  "nested in object",
+			input: map[string]interface{}{"a": float64(2), "b": map[string]interface{}{"!": "mul", "a": []interface{}{"!env", ":a"}, "b": float64(3)}},
+			want:  map[string]interface{}{"a": float64(2), "b": float64(6)},
+		},
+		{
+			name:    "missing argument",
+			input:   map[string]interface{}{"!": "add", "a": float64(1)},
+			wantErr: &EvalError{Stack: []StackFrame{{Function: "add"}}, Err: ErrorMissingArgument{Function: "add", Name: "b"}},
+		},
+		{
+			name:    "unknown argument",
+			input:   map[string]interface{}{"!": "add", "a": float64(1), "b": float64(2), "c": float64(3)},
+			wantErr: &EvalError{Stack: []StackFrame{{Function: "add"}}, Err: ErrorUnknownArgument{Function: "add", Name: "c"}},
+		},
+		{
+			name:    "unknown function",
+			input:   map[string]interface{}{"!": "nope"},
+			wantErr: &EvalError{Stack: []StackFrame{{Function: "nope"}}, Err: fmt.Errorf("no function found: %s", "nope")},
+		},
+		{
+			name:    "name not string",
+			input:   map[string]interface{}{"!": float64(1)},
+			wantErr: &EvalError{Err: fmt.Errorf("function name is empty or not string: %#v", float64(1))},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			in.Stdin = bufio.NewReader(strings.NewReader(tc.stdin))
+			got, err := in.Fun(tc.input)
+			if !reflect.DeepEqual(err, tc.wantErr) {
+				t.Fatalf("Fun(%v) error = %v, want %v", tc.input, err, tc.wantErr)
+			}
+			if tc.wantErr == nil && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Fun(%v) = %#v, want %#v", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFunKeepsProgram(t *testing.T) {
+	source := `[ [ "!def", "double", [ "x" ], [ "!mul", [ "!env", "$x" ], 2 ] ]
+, [ "!var", "base", [ "!input", { "type": "float", "question": "Base" } ] ]
+, { "doubled": [ "!double", [ "!env", "$base" ] ], "same": [ "!env", ":doubled" ] }
+, [ "!pairsToMap", [ "a", 1 ], [ "b", [ "!env", ":a" ] ] ]
+, [ "!choose", { "options": [ "x" ], "option-process": [ "!input", { "question": "Note", "predefined": "n" } ] } ]
+, [ "!item", 0, [ "!env", "." ] ]
+]`
+	var program interface{}
+	if err := json.Unmarshal([]byte(source), &program); err != nil {
+		t.Fatal(err)
+	}
+	before, err := json.Marshal(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := New()
+	in.Stdout = ioutil.Discard
+	want := []interface{}{
+		map[string]interface{}{"doubled": float64(4), "same": float64(4)},
+		map[string]interface{}{"a": float64(1), "b": float64(1)},
+		"n",
+		map[string]interface{}{"doubled": float64(4), "same": float64(4)},
+	}
+	for run := 0; run < 2; run++ {
+		in.Stdin = bufio.NewReader(strings.NewReader("2\n1\n\n"))
+		got, err := in.Fun(program)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("Fun() #%d = (%#v, %v), want (%#v, nil)", run, got, err, want)
+		}
+		after, err := json.Marshal(program)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(after) != string(before) {
+			t.Fatalf("Fun() #%d changed program\n%s\nto\n%s", run, before, after)
+		}
+	}
+}
@@ -1,17 +1,18 @@
 package funson
 
 import (
-	"bufio"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/mohae/deepcopy"
 )
 
 // used for variadic function results
@@ -38,7 +39,7 @@ func (e ErrorInvalidSignature) Error() string {
 	return fmt.Sprintf("function has to have at least 1 argument and first argument has to be *EnviromentNode type: %#v", e.Fun)
 }
 
-// Adds custom function "fun" to be used as "name" in funson
+// Adds custom function "fun" to be used as "name" in funson programs run by package level Fun.
 // "fun" has to be in format:
 //
 //	func(*funson.EnviromentNode, [arguments you want]) [your results]
@@ -46,7 +47,39 @@ func (e ErrorInvalidSignature) Error() string {
 // or if number of results is variable, use
 //
 //	func(*funson.EnviromentNode, [arguments you want]) funson.Result
+//
+// If the last result is error, it is not part of function results and non nil error fails the program, e.g.
+//
+//	func(*funson.EnviromentNode, [arguments you want]) ([your results], error)
 func AddFun(name string, fun interface{}) error {
+	return defaultInterpreter.AddFun(name, fun)
+}
+
+type ErrorParamsMismatch struct {
+	Name   string
+	Params []string
+}
+
+func (e ErrorParamsMismatch) Error() string {
+	return fmt.Sprintf("function %s has to have one argument for every parameter name %v (not counting *EnviromentNode)", e.Name, e.Params)
+}
+
+// Registered function.
+type function struct {
+	fun interface{}
+	// Names of function arguments (without *EnviromentNode), used to bind arguments in object form calls.
+	params []string
+	// Reflection of "fun", derived once when the function is added.
+	typ   reflect.Type
+	value reflect.Value
+	// Calls typed function without reflection, if the function was added by RegisterN function.
+	adapter adapter
+	// Description of the function, see Functions.
+	info FunctionInfo
+}
+
+// Validates and adds "fun" as "name" with parameter names "params" into "functions" registry.
+func addFun(functions map[string]function, name string, fun interface{}, params ...string) error {
 	//fmt.Println("addFunc", name)
 	//defer fmt.Println("addFunc", name, "out")
 	if fun == nil {
@@ -64,376 +97,1109 @@ func AddFun(name string, fun interface{}) error {
 	if t.NumIn() == 0 || t.In(0) != reflect.TypeOf(&EnviromentNode{}) {
 		return ErrorInvalidSignature{Fun: fun}
 	}
-	functions[name] = fun
+	if len(params) > 0 && len(params) != t.NumIn()-1 {
+		return ErrorParamsMismatch{Name: name, Params: params}
+	}
+	functions[name] = function{fun: fun, params: params, typ: t, value: reflect.ValueOf(fun)}
 	return nil
 }
 
-// Registered functions
-var functions map[string]interface{} = map[string]interface{}{}
+// Built-in functions, every new Interpreter starts with a copy of them.
+var builtins map[string]function = map[string]function{}
 
 var availableFuns = []struct {
 	name                       string
+	params                     []string
 	input, output, description string
 	function                   interface{}
 }{
 	{
-		"comment", "Any number of parameters of any type.", "Returns nothing.",
+		"comment", []string{"values"},
+		"Any number of parameters of any type.", "Returns nothing.",
 		"Does nothing. Doesn't even parse the parameters.",
 		func(en *EnviromentNode, _ ...interface{}) interface{} {
 			return Result{}
 		},
 	},
 	{
-		"print", "Any number of parameters of any type.", "Returns string.",
+		"print", []string{"values"},
+		"Any number of parameters of any type.", "Returns string.",
 		"Parses the parameters and the results are printed as JSON text strings to stderr separated by newline. The same string that is printed is returned.",
-		func(en *EnviromentNode, ps ...interface{}) string {
-			//TODO
-			return ""
-		},
+		printValues,
 	},
-}
+	{
+		"log", []string{"level", "values"},
+		"Level string (\"debug\", \"info\", \"warn\", \"error\") and any number of parameters of any type.", "Returns nothing.",
+		"Parses the parameters and logs the results separated by space by the interpreter's logger, strings as they are and other values as JSON. Messages below the interpreter's log level are not logged and their parameters are not parsed.",
+		logValues,
+	},
+	{
+		"if", []string{"condition", "then", "else"},
+		"Condition boolean, then and else of any type.", "Returns processed then or else.",
+		"Processes and returns \"then\" if the condition is true, \"else\" otherwise. The other one is not processed.",
+		func(en *EnviromentNode, cond bool, resTrue, resFalse interface{}) (interface{}, error) {
+			//log.Printf("if(cond: %#v, resTrue: %#v, resFalse: %#v)", cond, resTrue, resFalse)
+			unporcessedResut := resFalse
+			if cond {
+				unporcessedResut = resTrue
+			}
 
-func init() {
-	for _, af := range availableFuns {
-		if err := AddFun(af.name, af.function); err != nil {
-			panic(err)
-		}
-	}
+			return en.Process(unporcessedResut)
+		},
+	},
+	{
+		"not", []string{"value", "values"},
+		"One or more booleans.", "Returns booleans.",
+		"Returns negation of every parameter, one result for each.",
+		func(_ *EnviromentNode, a bool, va ...bool) (bool, Result) {
+			res := make(Result, len(va))
+			for i, b := range va {
+				res[i] = !b
+			}
+			return !a, res
+		},
+	},
+	{
+		"?and", []string{"value", "values"},
+		"Boolean and any number of parameters, which are processed to booleans.", "Returns boolean.",
+		"Returns true if all parameters are true. Parameters are processed in order only until one is false.",
+		func(en *EnviromentNode, a bool, va ...interface{}) (bool, error) {
+			if a == false {
+				return false, nil
+			}
+			for _, i := range va {
+				ri, err := en.Process(i)
+				if err != nil {
+					return false, err
+				}
+				rr, ok := ri.(Result)
+				if !ok {
+					rr = Result{rr}
+				}
+				for _, bi := range rr {
+					b, bok := bi.(bool)
+					if !bok {
+						return false, fmt.Errorf("and: process result %v not bool: %s, %#v", i, reflect.TypeOf(bi), bi)
+					}
+					if b == false {
+						return false, nil
+					}
+				}
+			}
+			return true, nil
+		},
+	},
+	{
+		"?or", []string{"value", "values"},
+		"Boolean and any number of parameters, which are processed to booleans.", "Returns boolean.",
+		"Returns true if some parameter is true. Parameters are processed in order only until one is true.",
+		func(en *EnviromentNode, a bool, va ...interface{}) (bool, error) {
+			if a == true {
+				return true, nil
+			}
+			for _, i := range va {
+				ri, err := en.Process(i)
+				if err != nil {
+					return false, err
+				}
+				rr, ok := ri.(Result)
+				if !ok {
+					rr = Result{rr}
+				}
+				for _, bi := range rr {
+					b, bok := bi.(bool)
+					if !bok {
+						return false, fmt.Errorf("or: process result %v not bool: %s, %#v", i, reflect.TypeOf(bi), bi)
+					}
+					if b == true {
+						return true, nil
+					}
+				}
+			}
+			return false, nil
+		},
+	},
+	{
+		"?eq", []string{"a", "b"},
+		"Two parameters of any type.", "Returns boolean.",
+		"Processes both parameters and returns true if their results are equal. Multiple results are compared as lists.",
+		func(en *EnviromentNode, a, b interface{}) (bool, error) {
+			//log.Printf("\neq:")
+			//log.Printf("eq: a, b: %#v, %#v", a, b)
+			var err error
+			a, err = en.Process(a)
+			if err != nil {
+				return false, err
+			}
+			if _, ok := a.(Result); !ok {
+				a = Result{a}
+			}
+			b, err = en.Process(b)
+			if err != nil {
+				return false, err
+			}
+			if _, ok := b.(Result); !ok {
+				b = Result{b}
+			}
+			//log.Printf("eq: processed a, b: %#v, %#v", a, b)
+			return reflect.DeepEqual(a, b), nil
+		},
+	},
+	{
+		"?env", []string{"path"},
+		"Path string, see env.", "Returns boolean.",
+		"Returns true if the path leads to a value, see env.",
+		func(en *EnviromentNode, path string) (bool, error) {
+			//log.Printf("isEnv(path: %#v)", path)
+			path = strings.TrimSpace(path)
+			if path == "" {
+				return false, fmt.Errorf("isEnv: path is empty")
+			}
 
-	// For historic reason, to run receipt.* examples.
-	// Work in progress, functions below will be described and moved to availableFuns array, some will be modified.
-	AddFun("if", func(en *EnviromentNode, cond bool, resTrue, resFalse interface{}) interface{} {
-		//log.Printf("if(cond: %#v, resTrue: %#v, resFalse: %#v)", cond, resTrue, resFalse)
-		unporcessedResut := resFalse
-		if cond {
-			unporcessedResut = resTrue
-		}
+			switch path[0] {
+			case '.', ':', '\\', '$':
+				key, rest := envKey(path)
+				dot, ok := en.FirstKey(key)
+				if !ok {
+					return false, nil
+				}
+				return isPathFunc(dot, rest), nil
+			default:
+				return false, fmt.Errorf("isEnv: unknown path prefix \"%v\"", string(path[0]))
+			}
+		},
+	},
+	{
+		"env", []string{"path"},
+		"Path string beginning with \".\" (partial results of enclosing array), \":\" (partial enclosing object), \"\\\" (value given by for or choose) or \"$name\" (variable or parameter), followed by keys separated by \".\".", "Returns value.",
+		"Returns the value at the path in the nearest enviroment holding its first part. Keys of path are looked up in every item of arrays.",
+		func(en *EnviromentNode, path string) (interface{}, error) {
+			//fmt.Printf("\nenv: p: %#v\n", path)
+			//fmt.Printf("env: e: %v\n", e)
+			//defer fmt.Printf("env: end\n\n")
+			path = strings.TrimSpace(path)
+			if path == "" {
+				return nil, fmt.Errorf("env: path is empty")
+			}
 
-		res, err := en.Process(unporcessedResut)
-		if err != nil {
-			panic(err.Error())
-		}
-		return res
-	})
-	AddFun("not", func(_ *EnviromentNode, a bool, va ...bool) (bool, Result) {
-		res := make(Result, len(va))
-		for i, b := range va {
-			res[i] = !b
-		}
-		return !a, res
-	})
-	AddFun("?and", func(en *EnviromentNode, a bool, va ...interface{}) bool {
-		if a == false {
-			return false
-		}
-		for _, i := range va {
-			ri, err := en.Process(i)
+			switch path[0] {
+			case '.', ':', '\\', '$':
+				key, rest := envKey(path)
+				dot, ok := en.FirstKey(key)
+				if !ok {
+					return nil, fmt.Errorf("env: no \"%s\" in enviroments: %v", key, path)
+				}
+				res, err := pathFunc(dot, rest)
+				if err != nil {
+					return nil, fmt.Errorf("cannot resolve path \"%s\" in %#v: %w", rest, dot, err)
+				}
+				return res, nil
+			default:
+				return nil, fmt.Errorf("env: unknown path prefix \"%v\"", string(path[0]))
+			}
+		},
+	},
+	{
+		"def", []string{"name", "params", "body"},
+		"Name string, array of parameter name strings and body of any type.", "Returns nothing.",
+		"Defines function called by name in the array (or object) enclosing the def call. The body is processed on every call with arguments bound to $ prefixed parameter names.",
+		func(en *EnviromentNode, name string, params []interface{}, body interface{}) (Result, error) {
+			if name == "" || name[0] == '!' {
+				return nil, fmt.Errorf("def: function name has to be non empty and can not begin with \"!\": %q", name)
+			}
+			ps, err := lambdaParams("def", params)
 			if err != nil {
-				panic(fmt.Sprintf("and: process %v failed: %s", i, err))
+				return nil, err
 			}
-			rr, ok := ri.(Result)
-			if !ok {
-				rr = Result{rr}
+			// Function is defined in enviroment enclosing the def call, so following siblings (and the function itself) can call it.
+			scope := en.scope()
+			if _, ok := scope.Enviroment["!"+name]; ok {
+				return nil, fmt.Errorf("def: function %s is already defined in this scope", name)
 			}
-			for _, bi := range rr {
-				b, bok := bi.(bool)
-				if !bok {
-					panic(fmt.Sprintf("and: process result %v not bool: %s, %#v", i, reflect.TypeOf(bi), bi))
+			scope.Enviroment["!"+name] = &Lambda{ps, body, en.nodePointer(body), scope}
+			return Result{}, nil
+		},
+	},
+	{
+		"let", []string{"bindings", "body"},
+		"Bindings object or array of [name, value] pairs, and body of any type.", "Returns processed body.",
+		"Processes the body with bound values accessible by $ prefixed names. Values of pairs are processed in order and can refer to previous bindings.",
+		func(en *EnviromentNode, bindings interface{}, body interface{}) (interface{}, error) {
+			scope := en.Child(Enviroment{
+				"type": "let",
+			})
+			switch typed := bindings.(type) {
+			case map[string]interface{}:
+				// Values are processed in enviroment of let call, so they can't refer to each other.
+				names := make([]string, 0, len(typed))
+				for name := range typed {
+					names = append(names, name)
 				}
-				if b == false {
-					return false
+				sort.Strings(names)
+				for _, name := range names {
+					if err := bindVariable(scope, en, "let", name, typed[name]); err != nil {
+						return nil, err
+					}
 				}
+			case []interface{}:
+				// Values are processed in order in the new scope, so they can refer to previous bindings.
+				for i, pairUntyped := range typed {
+					pair, ok := pairUntyped.([]interface{})
+					if !ok || len(pair) != 2 {
+						return nil, fmt.Errorf("let: binding #%d is not valid pair: pair has to be slice of length 2, not: %#v", i, pairUntyped)
+					}
+					name, ok := pair[0].(string)
+					if !ok {
+						return nil, fmt.Errorf("let: binding #%d is not valid pair: first item has to be string, not: %#v", i, pair[0])
+					}
+					if err := bindVariable(scope, scope, "let", name, pair[1]); err != nil {
+						return nil, err
+					}
+				}
+			default:
+				return nil, fmt.Errorf("let: bindings have to be object or array of pairs, not: %T", bindings)
 			}
-		}
-		return true
-	})
-	AddFun("?or", func(en *EnviromentNode, a bool, va ...interface{}) bool {
-		if a == true {
-			return true
-		}
-		for _, i := range va {
-			ri, err := en.Process(i)
+			return scope.Process(body)
+		},
+	},
+	{
+		"var", []string{"name", "value"},
+		"Name string and value of any type.", "Returns nothing.",
+		"Binds processed value to $ prefixed name in the array (or object) enclosing the var call, following items can use it.",
+		func(en *EnviromentNode, name string, value interface{}) (Result, error) {
+			// Variable is set in enviroment enclosing the var call, so following siblings can use it.
+			scope := en.scope()
+			if err := bindVariable(scope, en, "var", name, value); err != nil {
+				return nil, err
+			}
+			return Result{}, nil
+		},
+	},
+	{
+		"include", []string{"file"},
+		"File name string.", "Returns processed content of the file.",
+		"Processes funson file like it was written in place of the call. File is searched relative to the file containing the call, then in interpreter's Path.",
+		func(en *EnviromentNode, name string) (interface{}, error) {
+			mod, doc, err := loadModule(en, name)
 			if err != nil {
-				panic(fmt.Sprintf("or: process %v failed: %s", i, err))
+				return nil, fmt.Errorf("include: %w", err)
 			}
-			rr, ok := ri.(Result)
-			if !ok {
-				rr = Result{rr}
+			return mod.Process(doc)
+		},
+	},
+	{
+		"import", []string{"file"},
+		"File name string.", "Returns nothing.",
+		"Processes funson file and makes its top level functions (def) and variables (var) available in the array (or object) enclosing the import call.",
+		func(en *EnviromentNode, name string) (Result, error) {
+			mod, doc, err := loadModule(en, name)
+			if err != nil {
+				return nil, fmt.Errorf("import: %w", err)
 			}
-			for _, bi := range rr {
-				b, bok := bi.(bool)
-				if !bok {
-					panic(fmt.Sprintf("or: process result %v not bool: %s, %#v", i, reflect.TypeOf(bi), bi))
+			// Module is processed in own scope, so functions and variables defined in it can be exported afterwards.
+			var scope *EnviromentNode
+			switch typed := doc.(type) {
+			case []interface{}:
+				if !isSliceFunc(typed) {
+					scope = mod.Child(Enviroment{
+						"type": "slice",
+					})
+					_, err = scope.processSlice(typed)
 				}
-				if b == true {
-					return true
+			case map[string]interface{}:
+				if !isMapFunc(typed) {
+					scope = mod.Child(Enviroment{
+						"type": "map",
+					})
+					_, err = scope.processMap(typed)
 				}
 			}
-		}
-		return false
-	})
-	AddFun("?eq", func(en *EnviromentNode, a, b interface{}) bool {
-		//log.Printf("\neq:")
-		//log.Printf("eq: a, b: %#v, %#v", a, b)
-		var err error
-		a, err = en.Process(a)
-		if err != nil {
-			panic(fmt.Sprintf("eq: processing a %v failed: %s", a, err))
-		}
-		if _, ok := a.(Result); !ok {
-			a = Result{a}
-		}
-		b, err = en.Process(b)
-		if err != nil {
-			panic(fmt.Sprintf("eq: processing b %v failed: %s", b, err))
-		}
-		if _, ok := b.(Result); !ok {
-			b = Result{b}
-		}
-		//log.Printf("eq: processed a, b: %#v, %#v", a, b)
-		return reflect.DeepEqual(a, b)
-	})
-	AddFun("?env", func(en *EnviromentNode, path string) bool {
-		//log.Printf("isEnv(path: %#v)", path)
-		path = strings.TrimSpace(path)
+			if scope == nil {
+				return nil, fmt.Errorf("import: %s has to be an array or object, which is not a function", name)
+			}
+			if err != nil {
+				return nil, scope.evalError(err)
+			}
 
-		switch path[0] {
-		case '.', ':', '\\':
-			dot, ok := en.FirstKey(string([]byte{path[0]}))
-			if !ok {
-				return false
+			target := en.scope()
+			for k, v := range scope.Enviroment {
+				switch k[0] {
+				case '!':
+					if _, ok := target.Enviroment[k]; ok {
+						return nil, fmt.Errorf("import: function %s from %s is already defined in this scope", k[1:], name)
+					}
+				case '$':
+				default:
+					continue
+				}
+				target.Enviroment[k] = v
 			}
-			return isPathFunc(dot, path[1:])
-		default:
-			panic(fmt.Sprintf("isEnv: unknown path prefix \"%v\"", string(path[0])))
-		}
-		panic(fmt.Sprintf("isEnv: out of switch: %v", path))
-		return false
-	})
-	AddFun("env", func(en *EnviromentNode, path string) interface{} {
-		//fmt.Printf("\nenv: p: %#v\n", path)
-		//fmt.Printf("env: e: %v\n", e)
-		//defer fmt.Printf("env: end\n\n")
-		path = strings.TrimSpace(path)
-
-		switch path[0] {
-		case '.', ':', '\\':
-			dot, ok := en.FirstKey(string([]byte{path[0]}))
-			if !ok {
-				panic(fmt.Sprintf("env: no \"%s\" in enviroments: %v", string(path[0]), path))
-			}
-			res, err := pathFunc(dot, path[1:])
+			return Result{}, nil
+		},
+	},
+	{
+		"fn", []string{"params", "body"},
+		"Array of parameter name strings and body of any type.", "Returns function.",
+		"Creates anonymous function, which remembers the enviroment it was created in.",
+		func(en *EnviromentNode, params []interface{}, body interface{}) (*Lambda, error) {
+			ps, err := lambdaParams("fn", params)
 			if err != nil {
-				panic(fmt.Sprintf("cannot resolve path \"%s\" in %#v: %s", path[1:], dot, err))
+				return nil, err
 			}
-			return res
-		default:
-			panic(fmt.Sprintf("env: unknown path prefix \"%v\"", string(path[0])))
-		}
-		panic(fmt.Sprintf("out of switch: %v", path))
-		return nil
-	})
-	AddFun("for", func(en *EnviromentNode, cond interface{}, funs ...interface{}) Result {
-		//log.Printf("\nfor:")
-		res := Result{}
-		if !isSliceFunc(cond) {
-			panic(fmt.Sprintf("for: condition has to be a function: %v", cond))
-		}
-		for k := 0; true; k++ {
-			ne := en.Child(Enviroment{
-				"\\": map[string]interface{}{
-					"i": float64(k),
-				},
-			})
-			//log.Printf("for[%d]: cond: %v", k, cond)
-			if !isSliceFunc(cond) {
-				panic(fmt.Sprintf("for: [%d]: condition has to be a function: %v", k, cond))
+			scope := en.Parent()
+			if scope == nil {
+				scope = en
+			}
+			return &Lambda{ps, body, en.nodePointer(body), scope}, nil
+		},
+	},
+	{
+		"call", []string{"function", "args"},
+		"Function and any number of arguments of any type.", "Returns results of the function.",
+		"Calls the function with the arguments.",
+		func(en *EnviromentNode, f *Lambda, args ...interface{}) (interface{}, error) {
+			nodes := make([]argNode, len(args))
+			for i, arg := range args {
+				nodes[i] = argNode{value: arg, pointer: en.nodePointer(arg)}
 			}
-			cres, err := ne.Process(cond)
+			return en.callLambda("call", f, nodes...)
+		},
+	},
+	{
+		"map", []string{"function", "list"},
+		"Function and array.", "Returns array.",
+		"Calls the function with every item of the array and returns array of the results.",
+		func(en *EnviromentNode, f *Lambda, list interface{}) ([]interface{}, error) {
+			items, err := processList(en, "map", list)
+			if err != nil {
+				return nil, err
+			}
+			res := make([]interface{}, 0, len(items))
+			for _, item := range items {
+				ri, err := f.Call(en, item)
+				if err != nil {
+					return nil, err
+				}
+				if r, ok := ri.(Result); ok {
+					res = append(res, r...)
+					continue
+				}
+				res = append(res, ri)
+			}
+			return res, nil
+		},
+	},
+	{
+		"filter", []string{"function", "list"},
+		"Function returning boolean and array.", "Returns array.",
+		"Returns items of the array, for which the function returns true.",
+		func(en *EnviromentNode, f *Lambda, list interface{}) ([]interface{}, error) {
+			items, err := processList(en, "filter", list)
 			if err != nil {
-				panic(fmt.Sprintf("for: [%d]: condition process %v failed: %s", k, cond, err))
+				return nil, err
 			}
-			//log.Printf("for[%d]: cond result: %#v", k, cres)
-			if crr, ok := cres.(Result); ok {
-				if len(crr) != 1 {
-					panic(fmt.Sprintf("for: [%d]: condition's variadic result has to have only one return value: %v", k, crr))
+			res := make([]interface{}, 0, len(items))
+			for i, item := range items {
+				ri, err := singleResult(f.Call(en, item))
+				if err != nil {
+					return nil, err
+				}
+				keep, ok := ri.(bool)
+				if !ok {
+					return nil, fmt.Errorf("filter: item %d: function result has to be boolean", i)
+				}
+				if keep {
+					res = append(res, item)
 				}
-				cres = crr[0]
 			}
-			var cb, ok bool
-			if cb, ok = cres.(bool); !ok {
-				panic(fmt.Sprintf("for: [%d]: condition's result has to be boolean: %s, %#v", k, reflect.TypeOf(cres), cres))
+			return res, nil
+		},
+	},
+	{
+		"reduce", []string{"function", "initial", "list"},
+		"Function with two parameters, initial value of any type and array.", "Returns value.",
+		"Calls the function with the accumulated value (initial at first) and every item of the array in order, the result is accumulated value for the next item. Returns the last accumulated value.",
+		func(en *EnviromentNode, f *Lambda, initial interface{}, list interface{}) (interface{}, error) {
+			acc, err := singleResult(en.Process(initial))
+			if err != nil {
+				return nil, err
 			}
-			if cb == false {
-				break
+			items, err := processList(en, "reduce", list)
+			if err != nil {
+				return nil, err
 			}
-
-			for f, i := range funs {
-				nfe := ne.Child(Enviroment{
-					".": res,
+			for _, item := range items {
+				acc, err = singleResult(f.Call(en, acc, item))
+				if err != nil {
+					return nil, err
+				}
+			}
+			return acc, nil
+		},
+	},
+	{
+		"sortBy", []string{"function", "list"},
+		"Function returning number or string and array.", "Returns array.",
+		"Returns items of the array sorted by the function results, items with equal results keep their order.",
+		func(en *EnviromentNode, f *Lambda, list interface{}) ([]interface{}, error) {
+			items, err := processList(en, "sortBy", list)
+			if err != nil {
+				return nil, err
+			}
+			keys := make([]interface{}, len(items))
+			for i, item := range items {
+				keys[i], err = singleResult(f.Call(en, item))
+				if err != nil {
+					return nil, err
+				}
+				switch keys[i].(type) {
+				case float64, string:
+				default:
+					return nil, fmt.Errorf("sortBy: item %d: function result has to be number or string, not: %#v", i, keys[i])
+				}
+				if reflect.TypeOf(keys[i]) != reflect.TypeOf(keys[0]) {
+					return nil, fmt.Errorf("sortBy: item %d: can not compare %#v with: %#v", i, keys[0], keys[i])
+				}
+			}
+			indexes := make([]int, len(items))
+			for i := range indexes {
+				indexes[i] = i
+			}
+			sort.SliceStable(indexes, func(i, j int) bool {
+				if a, ok := keys[indexes[i]].(float64); ok {
+					return a < keys[indexes[j]].(float64)
+				}
+				return keys[indexes[i]].(string) < keys[indexes[j]].(string)
+			})
+			res := make([]interface{}, len(items))
+			for i, index := range indexes {
+				res[i] = items[index]
+			}
+			return res, nil
+		},
+	},
+	{
+		"for", []string{"condition", "body"},
+		"Condition function call and any number of body items of any type.", "Returns results of every iteration.",
+		"Processes the body items repeatedly while the condition is true. Iteration number from 0 is accessible as \"\\i\" path and results of previous iterations as \".\" path.",
+		func(en *EnviromentNode, cond interface{}, funs ...interface{}) (Result, error) {
+			//log.Printf("\nfor:")
+			res := Result{}
+			if !isSliceFunc(cond) {
+				return nil, fmt.Errorf("for: condition has to be a function: %v", cond)
+			}
+			for k := 0; true; k++ {
+				ne := en.Child(Enviroment{
+					"\\": map[string]interface{}{
+						"i": float64(k),
+					},
 				})
-				pres, err := nfe.Process(i)
+				//log.Printf("for[%d]: cond: %v", k, cond)
+				cres, err := ne.Process(cond)
 				if err != nil {
-					panic(fmt.Sprintf("for: [%d]: function %d process %v failed: %s", k, f, i, err))
+					return nil, err
 				}
-				if prr, ok := pres.(Result); ok {
-					res = append(res, prr...)
-					continue
+				//log.Printf("for[%d]: cond result: %#v", k, cres)
+				if crr, ok := cres.(Result); ok {
+					if len(crr) != 1 {
+						return nil, fmt.Errorf("for: [%d]: condition's variadic result has to have only one return value: %v", k, crr)
+					}
+					cres = crr[0]
+				}
+				var cb, ok bool
+				if cb, ok = cres.(bool); !ok {
+					return nil, fmt.Errorf("for: [%d]: condition's result has to be boolean: %s, %#v", k, reflect.TypeOf(cres), cres)
+				}
+				if cb == false {
+					break
+				}
+				if err := en.iteration(k); err != nil {
+					return nil, err
 				}
-				res = append(res, pres)
-			}
-		}
-		return res
-	})
-	AddFun("time.Format", func(en *EnviromentNode, t time.Time, l string) string {
-		return t.Format(l)
-	})
-	AddFun("time.Now", func(en *EnviromentNode) time.Time {
-		return time.Now()
-	})
-	AddFun("add", func(en *EnviromentNode, a, b float64) float64 {
-		return a + b
-	})
-	AddFun("sub", func(en *EnviromentNode, a, b float64) float64 {
-		return a - b
-	})
-	AddFun("mul", func(en *EnviromentNode, a, b float64) float64 {
-		return a * b
-	})
-	AddFun("ceil", func(en *EnviromentNode, a float64) float64 {
-		return math.Ceil(a)
-	})
-	AddFun("floor", func(en *EnviromentNode, a float64) float64 {
-		return math.Ceil(a)
-	})
-	AddFun("round", func(_ *EnviromentNode, f float64) float64 {
-		return round(f)
-	})
-	AddFun("roundN", func(_ *EnviromentNode, f float64, n float64) float64 {
-		in := int(n)
-		if n != float64(in) {
-			panic(fmt.Sprintf("roundN: n is not integer: %f", n))
-		}
-		if in == 0 {
+
+				for _, i := range funs {
+					nfe := ne.Child(Enviroment{
+						".": res,
+					})
+					pres, err := nfe.Process(i)
+					if err != nil {
+						return nil, err
+					}
+					if prr, ok := pres.(Result); ok {
+						res = append(res, prr...)
+						continue
+					}
+					res = append(res, pres)
+				}
+			}
+			return res, nil
+		},
+	},
+	{
+		"add", []string{"a", "b"},
+		"Two numbers.", "Returns number.",
+		"Returns sum of a and b.",
+		func(en *EnviromentNode, a, b float64) float64 {
+			return a + b
+		},
+	},
+	{
+		"sub", []string{"a", "b"},
+		"Two numbers.", "Returns number.",
+		"Returns a minus b.",
+		func(en *EnviromentNode, a, b float64) float64 {
+			return a - b
+		},
+	},
+	{
+		"mul", []string{"a", "b"},
+		"Two numbers.", "Returns number.",
+		"Returns product of a and b.",
+		func(en *EnviromentNode, a, b float64) float64 {
+			return a * b
+		},
+	},
+	{
+		"ceil", []string{"value"},
+		"Number.", "Returns number.",
+		"Returns the least integer greater than or equal to the value.",
+		func(en *EnviromentNode, a float64) float64 {
+			return math.Ceil(a)
+		},
+	},
+	{
+		"floor", []string{"value"},
+		"Number.", "Returns number.",
+		"Returns the greatest integer less than or equal to the value.",
+		func(en *EnviromentNode, a float64) float64 {
+			return math.Floor(a)
+		},
+	},
+	{
+		"round", []string{"value"},
+		"Number.", "Returns number.",
+		"Returns the nearest integer, halves are rounded away from zero.",
+		func(_ *EnviromentNode, f float64) float64 {
 			return round(f)
+		},
+	},
+	{
+		"roundN", []string{"value", "n"},
+		"Number and integer.", "Returns number.",
+		"Returns the value rounded to n decimal places like round, negative n rounds to tens, hundreds…",
+		func(_ *EnviromentNode, f float64, n float64) (float64, error) {
+			in := int(n)
+			if n != float64(in) {
+				return 0, fmt.Errorf("roundN: n is not integer: %f", n)
+			}
+			if in == 0 {
+				return round(f), nil
+			}
+			absn := in
+			if absn < 0 {
+				absn *= -1
+			}
+			exp := 1.0
+			for i := 0; i < absn; i++ {
+				exp *= 10
+			}
+			if in < 0 {
+				exp = 1 / exp
+			}
+			return round(f*exp) / exp, nil
+		},
+	},
+	{
+		"div", []string{"a", "b"},
+		"Two numbers.", "Returns number.",
+		"Returns a divided by b. Division by 0 is an error.",
+		func(en *EnviromentNode, a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("division by 0")
+			}
+			return a / b, nil
+		},
+	},
+	{
+		"sum", []string{"numbers"},
+		"Any number of numbers.", "Returns number.",
+		"Returns sum of the numbers, 0 if there are none.",
+		func(en *EnviromentNode, nums ...float64) float64 {
+			res := float64(0)
+			for _, n := range nums {
+				res += n
+			}
+			return res
+		},
+	},
+	{
+		"item", []string{"index", "array"},
+		"Integer index and array.", "Returns value.",
+		"Returns item of the array at the index counted from 0.",
+		func(en *EnviromentNode, index float64, array []interface{}) (interface{}, error) {
+			//log.Printf("item: params: {index: %f, array: %#v}", index, array)
+			n := int(index)
+			if float64(n) != index {
+				return nil, fmt.Errorf("item: index is not integer: %f", index)
+			}
+
+			processed, err := en.Process(array)
+			if err != nil {
+				return nil, err
+			}
+			//log.Printf("item: pocessed array: %#v", processed)
+
+			if processedResult, ok := processed.(Result); ok {
+				//log.Printf("item: pocessed array is Result: %#v", processedResult)
+				if len(processedResult) != 1 {
+					return nil, fmt.Errorf("item: processed array needs only 1 output, got %d: %v", len(processedResult), processedResult)
+				}
+
+				processedResultValue := reflect.ValueOf(processedResult[0])
+				processedResultKind := processedResultValue.Kind()
+				if processedResultKind != reflect.Array && processedResultKind != reflect.Slice {
+					return nil, fmt.Errorf("item: processed array output is not array, nor slice, got: %s", processedResultKind)
+				}
+				if n < 0 || n >= processedResultValue.Len() {
+					return nil, fmt.Errorf("item: index %d out of range, array has %d items", n, processedResultValue.Len())
+				}
+
+				res := processedResultValue.Index(n).Interface()
+				//log.Printf("item: returning %#v", res)
+				return res, nil
+			} else {
+				//TODO test this
+				if slice, ok := processed.([]interface{}); !ok {
+					return nil, fmt.Errorf("item: processed array is not []interface{}: %T", processed)
+				} else {
+					array = slice
+				}
+			}
+			//log.Printf("item: pocessed array result: %#v", array)
+
+			if n < 0 || n >= len(array) {
+				return nil, fmt.Errorf("item: index %d out of range, array has %d items", n, len(array))
+			}
+			return array[n], nil
+		},
+	},
+	{
+		"pairsToMap", []string{"pairs"},
+		"Any number of [key, value] pairs, key is string and value of any type.", "Returns object.",
+		"Returns object with processed values of pairs under their keys. The object built so far is accessible to values as \":\" path.",
+		func(en *EnviromentNode, pairs ...interface{}) (map[string]interface{}, error) {
+			out := map[string]interface{}{}
+			for i, pairUntyped := range pairs {
+				pair, ok := pairUntyped.([]interface{})
+				if !ok || len(pair) != 2 {
+					return nil, fmt.Errorf("pairsToMap: item #%d is not valid pair: pair has to be slice of length 2, not: %#v", i, pair)
+				}
+				key, ok := pair[0].(string)
+				if !ok {
+					return nil, fmt.Errorf("pairsToMap: item #%d is not valid pair: first item has to be string, not: %#v", i, pair[0])
+				}
+				if _, ok := out[key]; ok {
+					return nil, fmt.Errorf("pairsToMap: item #%d is not valid pair: duplicate pair key: %s", i, key)
+				}
+				// The object built so far is available to the value as ":" enviroment.
+				val, err := en.itemChild(nil, out).Process(pair[1])
+				if err != nil {
+					return nil, err
+				}
+				if res, ok := val.(Result); ok {
+					switch len(res) {
+					case 0:
+						out[key] = nil
+					case 1:
+						out[key] = res[0]
+					default:
+						return nil, fmt.Errorf("pairsToMap: to many results: %#v", res)
+					}
+					continue
+				}
+				out[key] = val
+			}
+			return out, nil
+		},
+	},
+	{
+		"concat", []string{"strings"},
+		"Any number of strings.", "Returns string.",
+		"Returns the strings joined together.",
+		func(_ *EnviromentNode, what ...string) string {
+			//log.Printf("concat(what: %#v)", what)
+			return strings.Join(what, "")
+		},
+	},
+	{
+		"split", []string{"separator", "string"},
+		"Separator string and string.", "Returns array of strings.",
+		"Splits the string to parts separated by the separator.",
+		func(_ *EnviromentNode, byWhat, where string) []string {
+			return strings.Split(where, byWhat)
+		},
+	},
+	{
+		"replacePrefix", []string{"find", "replace", "where"},
+		"Three strings.", "Returns string.",
+		"Returns the \"where\" string with prefix \"find\" replaced by \"replace\", unchanged if it doesn't begin with \"find\".",
+		func(en *EnviromentNode, find, replace, where string) string {
+			//log.Printf("replacePrefix(find: %#v, replace: %#v, where: %#v)", find, replace, where)
+			if !strings.HasPrefix(where, find) {
+				return where
+			}
+
+			return replace + strings.TrimPrefix(where, find)
+		},
+	},
+	{
+		"input", []string{},
+		"Object with optional keys: \"question\", \"type\" (\"string\", \"float\", \"integer\", \"datetime\"), \"predefined\", \"validator\" regular expression and its \"condition\" description, \"datetime-format-input\", \"datetime-format-output\" and \"id\".", "Returns value of the type.",
+		"Asks user the question by the interpreter's prompter and returns the answer converted to the type. Empty answer is replaced by predefined value, the question is asked again until the answer is valid.",
+		input,
+	},
+	{
+		"choose", []string{},
+		"Object with \"options\" array and optional keys: \"question\", \"option-text\", \"option-process\", \"predefined\" and \"id\".", "Returns processed chosen option.",
+		"Asks user to choose one of the options by the interpreter's prompter. Option texts are made by option-text, the chosen option is processed by option-process, if given. Empty answer returns processed predefined value, if there is one.",
+		choose,
+	},
+	{
+		"parallel", []string{"items"},
+		"Any number of parameters of any type.", "Returns array.",
+		"Processes the parameters concurrently and returns their results in order, like array would. Interactive functions can't be used in the parameters.",
+		parallel,
+	},
+	{
+		"time.Now", []string{},
+		"No parameters.", "Returns time.",
+		"Returns current time of the interpreter's clock.",
+		func(en *EnviromentNode) (time.Time, error) {
+			t := en.Now()
+			if r, ok := en.prompter().(*Replayer); ok {
+				// Replayed program fails, if it takes time more times than recorded.
+				return t, r.Err()
+			}
+			return t, nil
+		},
+	},
+	{
+		"time.Format", []string{"time", "layout"},
+		"Time is a string in RFC 3339 format (e.g. \"2026-01-02T15:04:05Z\") or result of time.Now. Layout is a string.", "Returns string.",
+		"Formats the time by Go layout, e.g. \"02.01.2006 15:04\".",
+		formatTime,
+	},
+	{
+		"time.Parse", []string{"layout", "value"},
+		"Layout and value are strings.", "Returns time as string in RFC 3339 format.",
+		"Parses the value by Go layout, e.g. \"02.01.2006\". Time without zone is in UTC.",
+		timeParse,
+	},
+	{
+		"time.ParseIn", []string{"layout", "value", "zone"},
+		"Layout, value and zone are strings.", "Returns time as string in RFC 3339 format.",
+		"Parses the value by Go layout like time.Parse, time without zone is in the zone, e.g. \"Europe/Bratislava\".",
+		timeParseIn,
+	},
+	{
+		"time.In", []string{"time", "zone"},
+		"Time is a string in RFC 3339 format (e.g. \"2026-01-02T15:04:05Z\") or result of time.Now. Zone is a string.", "Returns time as string in RFC 3339 format.",
+		"Returns the same instant in the zone, e.g. \"America/New_York\" or \"UTC\". Zones are embedded in the program.",
+		timeIn,
+	},
+	{
+		"time.Add", []string{"time", "duration"},
+		"Time is a string in RFC 3339 format (e.g. \"2026-01-02T15:04:05Z\") or result of time.Now. Duration is a string, e.g. \"90m\" or \"-1h30m\".", "Returns time as string in RFC 3339 format.",
+		"Returns the time moved by the duration.",
+		timeAdd,
+	},
+	{
+		"time.AddDate", []string{"time", "years", "months", "days"},
+		"Time is a string in RFC 3339 format (e.g. \"2026-01-02T15:04:05Z\") or result of time.Now. Years, months and days are integers.", "Returns time as string in RFC 3339 format.",
+		"Returns the time moved by the numbers of years, months and days, which can be negative.",
+		timeAddDate,
+	},
+	{
+		"time.Truncate", []string{"time", "unit"},
+		"Time is a string in RFC 3339 format (e.g. \"2026-01-02T15:04:05Z\") or result of time.Now. Unit is one of \"year\", \"month\", \"day\", \"hour\", \"minute\".", "Returns time as string in RFC 3339 format.",
+		"Returns the start of the year, month, day, hour or minute containing the time, in its zone.",
+		timeTruncate,
+	},
+	{
+		"time.Diff", []string{"from", "to", "unit"},
+		"From and to are times. Unit is one of \"days\", \"hours\", \"minutes\", \"seconds\".", "Returns number.",
+		"Returns time from \"from\" to \"to\" in the units, negative if \"to\" is before \"from\".",
+		timeDiff,
+	},
+	{
+		"time.Weekday", []string{"time"},
+		"Time is a string in RFC 3339 format (e.g. \"2026-01-02T15:04:05Z\") or result of time.Now.", "Returns string.",
+		"Returns english name of the day of week, e.g. \"Monday\".",
+		timeWeekday,
+	},
+	{
+		"time.Unix", []string{"time"},
+		"Time is a string in RFC 3339 format (e.g. \"2026-01-02T15:04:05Z\") or result of time.Now.", "Returns number.",
+		"Returns the time as number of seconds since January 1, 1970 UTC.",
+		timeUnix,
+	},
+	{
+		"time.FromUnix", []string{"seconds"},
+		"Number of seconds since January 1, 1970 UTC.", "Returns time as string in RFC 3339 format.",
+		"Returns the time in UTC.",
+		timeFromUnix,
+	},
+	{
+		"time.Before", []string{"a", "b"},
+		"Two times.", "Returns boolean.",
+		"Returns true if time a is before time b.",
+		timeBefore,
+	},
+	{
+		"time.After", []string{"a", "b"},
+		"Two times.", "Returns boolean.",
+		"Returns true if time a is after time b.",
+		timeAfter,
+	},
+	{
+		"time.Equal", []string{"a", "b"},
+		"Two times.", "Returns boolean.",
+		"Returns true if times a and b are the same instant, also if they are in different zones.",
+		timeEqual,
+	},
+}
+
+func init() {
+	for _, af := range availableFuns {
+		info := FunctionInfo{Input: af.input, Output: af.output, Description: af.description}
+		for _, p := range af.params {
+			info.Params = append(info.Params, ParamInfo{Name: p})
 		}
-		absn := in
-		if absn < 0 {
-			absn *= -1
-		}
-		exp := 1.0
-		for i := 0; i < absn; i++ {
-			exp *= 10
-		}
-		if in < 0 {
-			exp = 1 / exp
+		if err := addFunWithInfo(builtins, af.name, af.function, info); err != nil {
+			panic(err)
 		}
-		return round(f*exp) / exp
-	})
-	AddFun("div", func(en *EnviromentNode, a, b float64) float64 {
-		if b == 0 {
-			panic(fmt.Sprintf("division by 0"))
+	}
+
+	defaultInterpreter = New()
+}
+
+type ErrorModuleNotFound struct {
+	Name  string
+	Tried []string
+}
+
+func (e ErrorModuleNotFound) Error() string {
+	return fmt.Sprintf("file %q not found, tried: %s", e.Name, strings.Join(e.Tried, ", "))
+}
+
+type ErrorImportCycle struct{ Files []string }
+
+func (e ErrorImportCycle) Error() string {
+	return fmt.Sprintf("import cycle: %s", strings.Join(e.Files, " -> "))
+}
+
+// Returns absolute path of file "name" loaded in "en" enviroment.
+// Relative names are searched in the directory of the file being processed (or working directory) and then in interpreter's Path.
+func findModule(en *EnviromentNode, name string) (string, error) {
+	dirs := []string{""}
+	if !filepath.IsAbs(name) {
+		dirs[0] = "."
+		if file, ok := en.FirstKey("file"); ok {
+			dirs[0] = filepath.Dir(file.(string))
 		}
-		return a / b
-	})
-	AddFun("sum", func(en *EnviromentNode, nums ...float64) float64 {
-		res := float64(0)
-		for _, n := range nums {
-			res += n
+		dirs = append(dirs, en.Interpreter().Path...)
+	}
+	tried := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		file, err := filepath.Abs(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
 		}
-		return res
-	})
-	AddFun("item", func(en *EnviromentNode, index float64, array []interface{}) interface{} {
-		//log.Printf("item: params: {index: %f, array: %#v}", index, array)
-		n := int(index)
-		if float64(n) != index {
-			panic(fmt.Sprintf("item: index is not integer: %f", index))
+		if fi, err := os.Stat(file); err == nil && !fi.IsDir() {
+			return file, nil
 		}
+		tried = append(tried, file)
+	}
+	return "", ErrorModuleNotFound{Name: name, Tried: tried}
+}
 
-		processed, err := en.Process(array)
-		if err != nil {
-			panic(err.Error())
+// Reads and decodes file "name" loaded in "en" enviroment.
+// Returns decoded program and new root enviroment (with the same interpreter) to process it in.
+func loadModule(en *EnviromentNode, name string) (*EnviromentNode, interface{}, error) {
+	file, err := findModule(en, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	imports, _ := en.FirstKey("imports")
+	chain, _ := imports.([]string)
+	chain = append(chain[:len(chain):len(chain)], file)
+	for _, f := range chain[:len(chain)-1] {
+		if f == file {
+			return nil, nil, ErrorImportCycle{Files: chain}
 		}
-		//log.Printf("item: pocessed array: %#v", processed)
+	}
 
-		if processedResult, ok := processed.(Result); ok {
-			//log.Printf("item: pocessed array is Result: %#v", processedResult)
-			if len(processedResult) != 1 {
-				panic(fmt.Sprintf("item: processed array needs only 1 output, got %d: %v", len(processedResult), processedResult))
-			}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("decoding %s failed: %w", file, err)
+	}
 
-			processedResultValue := reflect.ValueOf(processedResult[0])
-			processedResultKind := processedResultValue.Kind()
-			if processedResultKind != reflect.Array && processedResultKind != reflect.Slice {
-				panic(fmt.Sprintf("item: processed array output is not array, nor slice, got: %s", processedResultKind))
-			}
+	mod := &EnviromentNode{
+		Enviroment: Enviroment{
+			"file":    file,
+			"imports": chain,
+		},
+		interpreter: en.Interpreter(),
+		stack:       en.stack,
+		eval:        en.eval,
+	}
+	return mod, doc, nil
+}
 
-			res := processedResultValue.Index(n).Interface()
-			//log.Printf("item: returning %#v", res)
-			return res
-		} else {
-			//TODO test this
-			if slice, ok := processed.([]interface{}); !ok {
-				panic(fmt.Sprintf("item: processed array is not []interface{}: %T", processed))
-			} else {
-				array = slice
-			}
+// Returns error if "name" is not valid variable name.
+func variableName(fname, name string) error {
+	if name == "" || strings.Contains(name, ".") {
+		return fmt.Errorf("%s: variable name has to be non empty and can not contain \".\": %q", fname, name)
+	}
+	return nil
+}
+
+// Returns "value" of variable "name" processed in "en" enviroment.
+// Value resulting in nothing is nil.
+func variableValue(en *EnviromentNode, fname, name string, value interface{}) (interface{}, error) {
+	res, err := en.Process(value)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := res.(Result); ok {
+		switch len(r) {
+		case 0:
+			return nil, nil
+		case 1:
+			return r[0], nil
+		default:
+			return nil, fmt.Errorf("%s: to many results for %q: %#v", fname, name, r)
+		}
+	}
+	return res, nil
+}
+
+// Binds "value" processed in "en" enviroment to variable "name" in "scope" enviroment.
+func bindVariable(scope, en *EnviromentNode, fname, name string, value interface{}) error {
+	if err := variableName(fname, name); err != nil {
+		return err
+	}
+	v, err := variableValue(en, fname, name, value)
+	if err != nil {
+		return err
+	}
+	scope.Enviroment["$"+name] = v
+	return nil
+}
+
+// Returns parameter names of function defined by "fname" function.
+func lambdaParams(fname string, params []interface{}) ([]string, error) {
+	ps := make([]string, len(params))
+	for i, p := range params {
+		ps[i], _ = p.(string)
+		if ps[i] == "" {
+			return nil, fmt.Errorf("%s: parameter %d has to be non empty string: %#v", fname, i, p)
 		}
-		//log.Printf("item: pocessed array result: %#v", array)
+	}
+	return ps, nil
+}
 
-		return array[n]
-	})
-	AddFun("pairsToMap", func(en *EnviromentNode, pairs ...interface{}) map[string]interface{} {
-		out := map[string]interface{}{}
-		for i, pairUntyped := range pairs {
-			pair, ok := pairUntyped.([]interface{})
-			if !ok || len(pair) != 2 {
-				panic(fmt.Sprintf("pairsToMap: item #%d is not valid pair: pair has to be slice of length 2, not: %#v", i, pair))
-			}
-			key, ok := pair[0].(string)
-			if !ok {
-				panic(fmt.Sprintf("pairsToMap: item #%d is not valid pair: first item has to be string, not: %#v", i, pair[0]))
-			}
-			if _, ok := out[key]; ok {
-				panic(fmt.Sprintf("pairsToMap: item #%d is not valid pair: duplicate pair key: %s", i, key))
-			}
-			en.Enviroment[":"] = out
-			val, err := en.Process(pair[1])
-			if err != nil {
-				panic(fmt.Sprintf("pairsToMap: can not compute value for key %s : %s", key, err))
-			}
-			if res, ok := val.(Result); ok {
-				switch len(res) {
-				case 0:
-					out[key] = nil
-				case 1:
-					out[key] = res[0]
-				default:
-					panic(fmt.Sprintf("pairsToMap: to many results: %#v", res))
-				}
-				continue
-			}
-			out[key] = val
+// Processes "list" and returns its items.
+// List can be an array, or a function returning an array or multiple values.
+func processList(en *EnviromentNode, fname string, list interface{}) ([]interface{}, error) {
+	processed, err := en.Process(list)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := processed.(Result); ok {
+		if len(r) != 1 {
+			return r, nil
 		}
-		return out
-	})
-	AddFun("concat", func(_ *EnviromentNode, what ...string) string {
-		//log.Printf("concat(what: %#v)", what)
-		return strings.Join(what, "")
-	})
-	AddFun("split", func(_ *EnviromentNode, byWhat, where string) []string {
-		return strings.Split(where, byWhat)
-	})
-	AddFun("replacePrefix", func(en *EnviromentNode, find, replace, where string) string {
-		//log.Printf("replacePrefix(find: %#v, replace: %#v, where: %#v)", find, replace, where)
-		if !strings.HasPrefix(where, find) {
-			return where
+		if k := reflect.ValueOf(r[0]).Kind(); k != reflect.Array && k != reflect.Slice {
+			return r, nil
 		}
+		processed = r[0]
+	}
+	if items, ok := processed.([]interface{}); ok {
+		return items, nil
+	}
+	v := reflect.ValueOf(processed)
+	if v.Kind() != reflect.Array && v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("%s: list is not array, got: %T", fname, processed)
+	}
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, nil
+}
 
-		return replace + strings.TrimPrefix(where, find)
-	})
-	AddFun("input", input)
-	AddFun("choose", choose)
+// Returns "v" if it is a function, or the function created by processing "v" if it is a "fn" function call.
+// Returns nil for other values.
+func lambdaValue(en *EnviromentNode, v interface{}) (*Lambda, error) {
+	if l, ok := v.(*Lambda); ok {
+		return l, nil
+	}
+	var name string
+	switch typed := v.(type) {
+	case []interface{}:
+		name, _ = sliceFunc(typed)
+	case map[string]interface{}:
+		name, _ = typed["!"].(string)
+	}
+	if name != "fn" {
+		return nil, nil
+	}
+	res, err := en.Process(v)
+	if err != nil {
+		return nil, err
+	}
+	res, err = singleResult(res, nil)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := res.(*Lambda)
+	if !ok {
+		return nil, fmt.Errorf("fn function result is not a function: %#v", res)
+	}
+	return l, nil
+}
+
+// Returns the only value of function result "v", or error if there is not exactly one value.
+func singleResult(v interface{}, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := v.(Result); ok {
+		if len(r) != 1 {
+			return nil, fmt.Errorf("want exactly one result, got %d: %v", len(r), r)
+		}
+		return r[0], nil
+	}
+	return v, nil
+}
+
+// Splits "path" to enviroment key and the rest of the path.
+// Key is the first character of path, or for "$" prefix the "$" with following name, e.g. "$name.rest" is split to "$name" and "rest".
+func envKey(path string) (string, string) {
+	if path[0] != '$' {
+		return path[:1], path[1:]
+	}
+	ps := strings.SplitN(path, ".", 2)
+	if len(ps) == 1 {
+		ps = append(ps, "")
+	}
+	return ps[0], ps[1]
 }
 
 func isPathFunc(i interface{}, path string) bool {
@@ -575,24 +1341,30 @@ func stringRetype(_type, input string, datetimeFormat timeFormat) (interface{},
 		}
 		return t.Format(datetimeFormat.output), nil
 	}
-	panic(fmt.Sprintf("input: can not retype input string to: %s", _type))
-	return nil, nil
+	return nil, fmt.Errorf("input: can not retype input string to: %s", _type)
 }
 
-var reader *bufio.Reader = bufio.NewReader(os.Stdin)
+func input(en *EnviromentNode, options map[string]interface{}) (interface{}, error) {
+	if err := en.interactive(); err != nil {
+		return nil, err
+	}
+	// Options are copied, so defaults are not written into the program.
+	o := make(map[string]interface{}, len(options)+6)
+	for k, v := range options {
+		o[k] = v
+	}
 
-func input(en *EnviromentNode, o map[string]interface{}) interface{} {
 	if _, ok := o["type"]; !ok {
 		o["type"] = "string"
 	} else if _, ok := o["type"].(string); !ok {
-		panic(fmt.Sprintf("input: want \"string\" type of \"type\": %v", reflect.TypeOf(o["type"])))
+		return nil, fmt.Errorf("input: want \"string\" type of \"type\": %v", reflect.TypeOf(o["type"]))
 	}
 	_type := o["type"].(string)
 
 	switch _type {
 	case "string", "float", "integer", "datetime":
 	default:
-		panic(fmt.Sprintf("input: unknown \"type\": %s", _type))
+		return nil, fmt.Errorf("input: unknown \"type\": %s", _type)
 	}
 
 	_datetimeFormat := timeFormat{}
@@ -600,14 +1372,14 @@ func input(en *EnviromentNode, o map[string]interface{}) interface{} {
 		if _, ok := o["datetime-format-input"]; !ok {
 			o["datetime-format-input"] = time.RFC822
 		} else if _, ok := o["datetime-format-input"].(string); !ok {
-			panic(fmt.Sprintf("input: want \"string\" type of \"datetime-format-input\": %v", reflect.TypeOf(o["datetime-format-input"])))
+			return nil, fmt.Errorf("input: want \"string\" type of \"datetime-format-input\": %v", reflect.TypeOf(o["datetime-format-input"]))
 		}
 		_datetimeFormat.input = o["datetime-format-input"].(string)
 
 		if _, ok := o["datetime-format-output"]; !ok {
 			o["datetime-format-output"] = time.RFC822
 		} else if _, ok := o["datetime-format-output"].(string); !ok {
-			panic(fmt.Sprintf("input: want \"string\" type of \"datetime-format-output\": %v", reflect.TypeOf(o["datetime-format-output"])))
+			return nil, fmt.Errorf("input: want \"string\" type of \"datetime-format-output\": %v", reflect.TypeOf(o["datetime-format-output"]))
 		}
 		_datetimeFormat.output = o["datetime-format-output"].(string)
 	}
@@ -615,22 +1387,26 @@ func input(en *EnviromentNode, o map[string]interface{}) interface{} {
 	if _, ok := o["question"]; !ok {
 		o["question"] = "Enter input"
 	} else if _, ok := o["question"].(string); !ok {
-		panic(fmt.Sprintf("input: want \"string\" type for \"question\": %v", reflect.TypeOf(o["question"])))
+		return nil, fmt.Errorf("input: want \"string\" type for \"question\": %v", reflect.TypeOf(o["question"]))
 	}
 	_question := o["question"].(string)
 
-	//TODO do not change predefined
+	_id, ok := o["id"].(string)
+	if _, has := o["id"]; has && !ok {
+		return nil, fmt.Errorf("input: want \"string\" type for \"id\": %v", reflect.TypeOf(o["id"]))
+	}
+
 	if pi, ok := o["predefined"]; ok {
 		nen := en.Child(Enviroment{
 			":": o,
 		})
 		npi, err := nen.Process(pi)
 		if err != nil {
-			panic(fmt.Sprintf("input: processing \"predefined\" error: %s", err))
+			return nil, err
 		}
 		if npr, ok := npi.(Result); ok {
 			if len(npr) != 1 {
-				panic(fmt.Sprintf("input: want only 1 \"predefined\"  result: %v", npr))
+				return nil, fmt.Errorf("input: want only 1 \"predefined\"  result: %v", npr)
 			}
 			npi = npr[0]
 		}
@@ -642,56 +1418,57 @@ func input(en *EnviromentNode, o map[string]interface{}) interface{} {
 	} else if f, ok := o["predefined"].(float64); ok {
 		o["predefined"] = fmt.Sprintf("%f", f)
 	} else if _, ok := o["predefined"].(string); !ok {
-		panic(fmt.Sprintf("input: want \"string\" type for \"predefined\": %v", reflect.TypeOf(o["predefined"])))
+		return nil, fmt.Errorf("input: want \"string\" type for \"predefined\": %v", reflect.TypeOf(o["predefined"]))
 	}
 	_predefined := o["predefined"].(string)
-	if _predefined != "" {
-		_question += " [" + _predefined + "]"
-	}
 
 	var _validator *regexp.Regexp
 	if _, ok := o["validator"]; !ok {
 		o["validator"] = ""
 	} else if _, ok := o["validator"].(string); !ok {
-		panic(fmt.Sprintf("input: want \"string\" type for \"validator\": %v", reflect.TypeOf(o["validator"])))
+		return nil, fmt.Errorf("input: want \"string\" type for \"validator\": %v", reflect.TypeOf(o["validator"]))
 	}
 	_expression := o["validator"].(string)
 	if _expression != "" {
 		var err error
 		_validator, err = regexp.Compile(_expression)
 		if err != nil {
-			panic(fmt.Sprintf("input: \"validator\" is not regexp compilant: %s", err))
+			return nil, fmt.Errorf("input: \"validator\" is not regexp compilant: %w", err)
 		}
 	}
 
 	if _validator != nil && _predefined != "" {
 		if !_validator.Match([]byte(_predefined)) {
-			panic(fmt.Sprintf("input: \"predefined\" doesn't pass \"validator\""))
+			return nil, fmt.Errorf("input: \"predefined\" doesn't pass \"validator\"")
 		}
 	}
 
 	if _predefined != "" {
 		if _, err := stringRetype(_type, _predefined, _datetimeFormat); err != nil {
-			panic(fmt.Sprintf("String \"predefined\" %s", err))
+			return nil, fmt.Errorf("String \"predefined\" %w", err)
 		}
 	}
 
 	if _, ok := o["condition"]; !ok {
 		o["condition"] = ""
 	} else if _, ok := o["condition"].(string); !ok {
-		panic(fmt.Sprintf("input: want \"string\" type for \"condition\": %v", reflect.TypeOf(o["condition"])))
+		return nil, fmt.Errorf("input: want \"string\" type for \"condition\": %v", reflect.TypeOf(o["condition"]))
 	}
 	_condition := o["condition"].(string)
 
 	if _validator != nil && _condition == "" {
-		panic(fmt.Sprintf("input: you forgot to fill \"validator\" description into \"condition\" field"))
+		return nil, fmt.Errorf("input: you forgot to fill \"validator\" description into \"condition\" field")
 	}
 
+	prompter, ctx := en.prompter(), en.Context()
+	question := Question{ID: _id, Text: _question, Predefined: _predefined}
 	var res interface{}
 
 	for res == nil {
-		fmt.Printf("\n%s: ", _question)
-		input, _ := reader.ReadString('\n')
+		input, err := prompter.Ask(ctx, question)
+		if err != nil {
+			return nil, err
+		}
 		input = strings.TrimSpace(input)
 
 		if input == "" && _predefined != "" {
@@ -700,34 +1477,45 @@ func input(en *EnviromentNode, o map[string]interface{}) interface{} {
 
 		if _validator != nil {
 			if !_validator.Match([]byte(input)) {
-				fmt.Println("Entered value doesn't pass condition.")
-				fmt.Println(_condition)
+				if err := prompter.Show(ctx, "Entered value doesn't pass condition.\n"+_condition); err != nil {
+					return nil, err
+				}
 				continue
 			}
 		}
 		inputRetyped, err := stringRetype(_type, input, _datetimeFormat)
 		if err != nil {
-			fmt.Printf("Entered value %s", err)
+			if err := prompter.Show(ctx, "Entered value "+err.Error()); err != nil {
+				return nil, err
+			}
 			continue
 		}
 		res = inputRetyped
 	}
-	return res
+	return res, nil
 }
 
-func choose(en *EnviromentNode, o map[string]interface{}) interface{} {
+func choose(en *EnviromentNode, o map[string]interface{}) (interface{}, error) {
+	if err := en.interactive(); err != nil {
+		return nil, err
+	}
 	//log.Printf("\nchoose: %v", o)
 	//defer log.Printf("choose: end")
 	if _, ok := o["options"].([]interface{}); !ok {
-		panic(fmt.Sprintf("input: want \"[]interface{}\" type for \"options\": %v", reflect.TypeOf(o["options"])))
+		return nil, fmt.Errorf("input: want \"[]interface{}\" type for \"options\": %v", reflect.TypeOf(o["options"]))
 	}
 	_options := o["options"].([]interface{})
 
 	if len(_options) == 0 {
 		if o["predefined"] != nil {
-			return o["predefined"]
+			return o["predefined"], nil
 		}
-		return Result{}
+		return Result{}, nil
+	}
+
+	optionText, err := lambdaValue(en, o["option-text"])
+	if err != nil {
+		return nil, err
 	}
 
 	options := make([]struct {
@@ -739,7 +1527,7 @@ func choose(en *EnviromentNode, o map[string]interface{}) interface{} {
 		switch _oTyped := _o.(type) {
 		case []interface{}:
 			if len(_oTyped) != 2 {
-				panic(fmt.Sprintf("choose: %d option is slice and has to have only two items (option, text): %v", i, _o))
+				return nil, fmt.Errorf("choose: %d option is slice and has to have only two items (option, text): %v", i, _o)
 			}
 			options[i].option = _oTyped[1]
 			ne := en.Child(Enviroment{
@@ -747,11 +1535,11 @@ func choose(en *EnviromentNode, o map[string]interface{}) interface{} {
 			})
 			ores, err := ne.Process(_oTyped[0])
 			if err != nil {
-				panic(fmt.Sprintf("choose: processing option %d text failed: %s", i, err))
+				return nil, err
 			}
 			if orr, ok := ores.(Result); ok {
 				if len(orr) != 1 {
-					panic(fmt.Sprintf("choose: want only one option %d text result: %v", i, orr))
+					return nil, fmt.Errorf("choose: want only one option %d text result: %v", i, orr)
 				}
 				ores = orr[0]
 			}
@@ -760,17 +1548,23 @@ func choose(en *EnviromentNode, o map[string]interface{}) interface{} {
 			//TODO duplicate code
 			options[i].option = _o
 			options[i].text = fmt.Sprintf("%v", _o)
-			if ot, ok := o["option-text"]; ok {
+			if optionText != nil {
+				ores, err := singleResult(optionText.Call(en, _o))
+				if err != nil {
+					return nil, err
+				}
+				options[i].text = fmt.Sprintf("%v", ores)
+			} else if ot, ok := o["option-text"]; ok {
 				ne := en.Child(Enviroment{
 					":": _o,
 				})
 				_ores, err := ne.Process(ot)
 				if err != nil {
-					panic(fmt.Sprintf("choose: processing option %d option-text failed: %s", i, err))
+					return nil, err
 				}
 				if orr, ok := _ores.(Result); ok {
 					if len(orr) != 1 {
-						panic(fmt.Sprintf("choose: want only one option %d text result: %v", i, orr))
+						return nil, fmt.Errorf("choose: want only one option %d text result: %v", i, orr)
 					}
 					_ores = orr[0]
 				}
@@ -779,63 +1573,83 @@ func choose(en *EnviromentNode, o map[string]interface{}) interface{} {
 		}
 	}
 
-	if _, ok := o["question"]; !ok {
-		o["question"] = "Choose an option"
+	_question := "Choose an option"
+	if q, ok := o["question"]; !ok {
 		if o["predefined"] != nil {
-			o["question"] = o["question"].(string) + " or don't"
+			_question += " or don't"
 		}
-	} else if _, ok := o["question"].(string); !ok {
-		panic(fmt.Sprintf("input: want \"string\" type for \"question\": %v", reflect.TypeOf(o["question"])))
+	} else if _question, ok = q.(string); !ok {
+		return nil, fmt.Errorf("input: want \"string\" type for \"question\": %v", reflect.TypeOf(q))
 	}
-	_question := o["question"].(string)
 
+	_id, ok := o["id"].(string)
+	if _, has := o["id"]; has && !ok {
+		return nil, fmt.Errorf("choose: want \"string\" type for \"id\": %v", reflect.TypeOf(o["id"]))
+	}
+
+	prompter, ctx := en.prompter(), en.Context()
+	question := Question{ID: _id, Text: _question, Options: make([]string, len(options))}
+	for i, option := range options {
+		question.Options[i] = option.text
+	}
 	var res interface{}
 	for res == nil {
-		fmt.Printf("\nOptions:\n")
-		for i, option := range options {
-			fmt.Printf("%d) %s\n", i+1, option.text)
+		input, err := prompter.AskChoice(ctx, question)
+		if err != nil {
+			return nil, err
 		}
-		fmt.Printf("%s: ", _question)
-		input, _ := reader.ReadString('\n')
 		input = strings.TrimSpace(input)
 
 		if input == "" {
 			if o["predefined"] != nil {
 				defres, err := en.Process(o["predefined"])
 				if err != nil {
-					panic(fmt.Sprintf("choose: processing predefined result failed: %s", err))
+					return nil, err
 				}
-				return defres
+				return defres, nil
+			}
+			if err := prompter.Show(ctx, "You have to choose some option"); err != nil {
+				return nil, err
 			}
-			fmt.Printf("You have to choose some option\n")
 			continue
 		}
 		inputInt, err := strconv.Atoi(input)
 		if err != nil {
-			fmt.Println("Choose by entering option number")
+			if err := prompter.Show(ctx, "Choose by entering option number"); err != nil {
+				return nil, err
+			}
 			continue
 		}
 		if inputInt < 1 || inputInt > len(options) {
-			fmt.Println("Choose a number from list.")
+			if err := prompter.Show(ctx, "Choose a number from list."); err != nil {
+				return nil, err
+			}
 			continue
 		}
 		res = options[inputInt-1].option
 	}
-	res, err := en.Process(res)
+	res, err = en.Process(res)
 	if err != nil {
-		panic(fmt.Sprintf("choose: processing choosen result failed: %s", err))
+		return nil, err
 	}
-	if op, ok := o["option-process"]; ok {
+	if l, err := lambdaValue(en, o["option-process"]); err != nil {
+		return nil, err
+	} else if l != nil {
+		opres, err := l.Call(en, res)
+		if err != nil {
+			return nil, err
+		}
+		res = opres
+	} else if op, ok := o["option-process"]; ok {
 		ne := en.Child(Enviroment{
 			"\\": res,
 		})
 		//log.Printf("choose: %v.Process(%#v)", ne.Enviroment, op)
-		//TODO dont usecopy, repair input
-		opres, err := ne.Process(deepcopy.Copy(op))
+		opres, err := ne.Process(op)
 		if err != nil {
-			panic(fmt.Sprintf("choose: processing option-process for choosen result failed: %s", err))
+			return nil, err
 		}
 		res = opres
 	}
-	return res
+	return res, nil
 }
@@ -2,6 +2,11 @@ package funson
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -9,8 +14,8 @@ import (
 )
 
 // copyMap returns a shallow copy of the provided map.
-func copyMap(src map[string]interface{}) map[string]interface{} {
-	dst := make(map[string]interface{}, len(src))
+func copyMap(src map[string]function) map[string]function {
+	dst := make(map[string]function, len(src))
 	for k, v := range src {
 		dst[k] = v
 	}
@@ -18,16 +23,14 @@ func copyMap(src map[string]interface{}) map[string]interface{} {
 }
 
 func TestAddFun(t *testing.T) {
-	origFunctions := copyMap(functions)
-	defer func() { functions = origFunctions }()
-
 	dummy := func(en *EnviromentNode) {}
 	other := func(en *EnviromentNode) {}
 
 	tests := []struct {
 		name      string
-		functions map[string]interface{}
+		functions map[string]function
 		funName   string
+		params    []string
 		fun       interface{}
 		wantErr   error
 	}{
@@ -47,7 +50,7 @@ func TestAddFun(t *testing.T) {
 		},
 		{
 			name:      "duplicate name",
-			functions: map[string]interface{}{"dup": dummy},
+			functions: map[string]function{"dup": {fun: dummy}},
 			funName:   "dup",
 			fun:       other,
 			wantErr:   ErrorDuplicateFunctionName{Name: "dup"},
@@ -59,18 +62,33 @@ func TestAddFun(t *testing.T) {
 			fun:       123,
 			wantErr:   ErrorNotFunction{Type: reflect.TypeOf(123)},
 		},
+		{
+			name:      "named parameters",
+			functions: nil,
+			funName:   "named",
+			params:    []string{"a", "b"},
+			fun:       func(en *EnviromentNode, a, b float64) {},
+			wantErr:   nil,
+		},
+		{
+			name:      "parameter names mismatch",
+			functions: nil,
+			funName:   "mismatch",
+			params:    []string{"a", "b"},
+			fun:       dummy,
+			wantErr:   ErrorParamsMismatch{Name: "mismatch", Params: []string{"a", "b"}},
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			if tc.functions == nil {
-				functions = map[string]interface{}{}
-			} else {
+			functions := map[string]function{}
+			if tc.functions != nil {
 				functions = copyMap(tc.functions)
 			}
 			original := copyMap(functions)
 
-			err := AddFun(tc.funName, tc.fun)
+			err := addFun(functions, tc.funName, tc.fun, tc.params...)
 			if !reflect.DeepEqual(err, tc.wantErr) {
 				t.Fatalf("AddFun(%q) error = %v, wantErr %v", tc.funName, err, tc.wantErr)
 			}
@@ -84,7 +102,7 @@ func TestAddFun(t *testing.T) {
 						t.Errorf("missing function %q after error", k)
 						continue
 					}
-					if reflect.ValueOf(got).Pointer() != reflect.ValueOf(v).Pointer() {
+					if reflect.ValueOf(got.fun).Pointer() != reflect.ValueOf(v.fun).Pointer() {
 						t.Errorf("function %q changed", k)
 					}
 				}
@@ -95,15 +113,17 @@ func TestAddFun(t *testing.T) {
 				t.Errorf("len(functions) = %d, want %d", len(functions), len(original)+1)
 			}
 			for k, v := range original {
-				if functions[k] != v {
+				if reflect.ValueOf(functions[k].fun).Pointer() != reflect.ValueOf(v.fun).Pointer() {
 					t.Errorf("existing function %q changed", k)
 				}
 			}
 			got, ok := functions[tc.funName]
 			if !ok {
 				t.Errorf("function %q not registered", tc.funName)
-			} else if reflect.ValueOf(got).Pointer() != reflect.ValueOf(tc.fun).Pointer() {
+			} else if reflect.ValueOf(got.fun).Pointer() != reflect.ValueOf(tc.fun).Pointer() {
 				t.Errorf("registered function mismatch")
+			} else if !reflect.DeepEqual(got.params, tc.params) {
+				t.Errorf("registered params = %v, want %v", got.params, tc.params)
 			}
 		})
 	}
@@ -223,12 +243,38 @@ func TestRound(t *testing.T) {
 	}
 }
 
+func TestCeilAndFloor(t *testing.T) {
+	tests := []struct {
+		input     float64
+		wantCeil  float64
+		wantFloor float64
+	}{
+		{0, 0, 0},
+		{1.2, 2, 1},
+		{-1.2, -1, -2},
+		{3, 3, 3},
+	}
+
+	for _, tc := range tests {
+		for _, f := range []struct {
+			name string
+			want float64
+		}{{"ceil", tc.wantCeil}, {"floor", tc.wantFloor}} {
+			input := []interface{}{"!" + f.name, tc.input}
+			got, err := Fun(input)
+			if err != nil || got != f.want {
+				t.Errorf("Fun(%v) = (%v, %v), want (%v, nil)", input, got, err, f.want)
+			}
+		}
+	}
+}
+
 func TestRoundN(t *testing.T) {
-	rn, ok := functions["roundN"].(func(*EnviromentNode, float64, float64) float64)
+	rn, ok := builtins["roundN"].fun.(func(*EnviromentNode, float64, float64) (float64, error))
 	if !ok {
 		t.Fatalf("roundN has unexpected type")
 	}
-	en := &EnviromentNode{Enviroment{}, nil}
+	en := &EnviromentNode{Enviroment: Enviroment{}}
 
 	tests := []struct {
 		name string
@@ -251,7 +297,10 @@ func TestRoundN(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			got := rn(en, tc.f, tc.n)
+			got, err := rn(en, tc.f, tc.n)
+			if err != nil {
+				t.Fatalf("functions[\"roundN\"](%v, %v) error = %v", tc.f, tc.n, err)
+			}
 			if !reflect.DeepEqual(got, tc.want) {
 				t.Fatalf("functions[\"roundN\"](%v, %v) = %v, want %v", tc.f, tc.n, got, tc.want)
 			}
@@ -260,19 +309,19 @@ func TestRoundN(t *testing.T) {
 }
 
 func TestItem(t *testing.T) {
-	it, ok := functions["item"].(func(*EnviromentNode, float64, []interface{}) interface{})
+	it, ok := builtins["item"].fun.(func(*EnviromentNode, float64, []interface{}) (interface{}, error))
 	if !ok {
 		t.Fatalf("item has unexpected type")
 	}
-	en := &EnviromentNode{Enviroment{}, nil}
+	en := &EnviromentNode{Enviroment: Enviroment{}}
 
 	tests := []struct {
-		name      string
-		index     float64
-		array     []interface{}
-		useChild  bool
-		want      interface{}
-		wantPanic bool
+		name     string
+		index    float64
+		array    []interface{}
+		useChild bool
+		want     interface{}
+		wantErr  bool
 	}{
 		{
 			name:  "plain slice",
@@ -288,10 +337,23 @@ func TestItem(t *testing.T) {
 			want:     "b",
 		},
 		{
-			name:      "non integer index",
-			index:     1.5,
-			array:     []interface{}{"a", "b"},
-			wantPanic: true,
+			name:    "non integer index",
+			index:   1.5,
+			array:   []interface{}{"a", "b"},
+			wantErr: true,
+		},
+		{
+			name:    "index out of range",
+			index:   2,
+			array:   []interface{}{"a", "b"},
+			wantErr: true,
+		},
+		{
+			name:     "result index out of range",
+			index:    3,
+			array:    []interface{}{"!split", ",", "a,b,c"},
+			useChild: true,
+			wantErr:  true,
 		},
 	}
 
@@ -301,17 +363,11 @@ func TestItem(t *testing.T) {
 			if tc.useChild {
 				itemEnv = en.Child(Enviroment{})
 			}
-			if tc.wantPanic {
-				defer func() {
-					if recover() == nil {
-						t.Errorf("item(%v, %v) did not panic", tc.index, tc.array)
-					}
-				}()
-				it(itemEnv, tc.index, tc.array)
-				return
+			got, err := it(itemEnv, tc.index, tc.array)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("item(%v, %v) error = %v, wantErr %v", tc.index, tc.array, err, tc.wantErr)
 			}
-			got := it(itemEnv, tc.index, tc.array)
-			if !reflect.DeepEqual(got, tc.want) {
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
 				t.Errorf("item(%v, %v) = %#v, want %#v", tc.index, tc.array, got, tc.want)
 			}
 		})
@@ -351,9 +407,9 @@ func TestStringRetype(t *testing.T) {
 }
 
 func TestInput(t *testing.T) {
-	en := &EnviromentNode{Enviroment{}, nil}
-	origReader := reader
-	defer func() { reader = origReader }()
+	in := New()
+	in.Stdout = ioutil.Discard
+	en := &EnviromentNode{Enviroment: Enviroment{}, interpreter: in}
 
 	tests := []struct {
 		name        string
@@ -383,8 +439,11 @@ func TestInput(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			reader = bufio.NewReader(strings.NewReader(tc.readerInput))
-			got := input(en, tc.options)
+			in.Stdin = bufio.NewReader(strings.NewReader(tc.readerInput))
+			got, err := input(en, tc.options)
+			if err != nil {
+				t.Fatalf("input(%v) error = %v", tc.options, err)
+			}
 			if !reflect.DeepEqual(got, tc.want) {
 				t.Errorf("input(%v) = %#v, want %#v", tc.options, got, tc.want)
 			}
@@ -393,9 +452,9 @@ func TestInput(t *testing.T) {
 }
 
 func TestChoose(t *testing.T) {
-	en := &EnviromentNode{Enviroment{}, nil}
-	origReader := reader
-	defer func() { reader = origReader }()
+	in := New()
+	in.Stdout = ioutil.Discard
+	en := &EnviromentNode{Enviroment: Enviroment{}, interpreter: in}
 
 	tests := []struct {
 		name        string
@@ -415,15 +474,437 @@ func TestChoose(t *testing.T) {
 			options:     map[string]interface{}{"options": []interface{}{"x", "y"}, "predefined": "y"},
 			want:        "y",
 		},
+		{
+			name:        "lambda option text and process",
+			readerInput: "1\n",
+			options: map[string]interface{}{
+				"options":        []interface{}{map[string]interface{}{"name": "a", "price": float64(2)}},
+				"option-text":    []interface{}{"!fn", []interface{}{"o"}, []interface{}{"!env", "$o.name"}},
+				"option-process": []interface{}{"!fn", []interface{}{"o"}, []interface{}{"!mul", []interface{}{"!env", "$o.price"}, float64(3)}},
+			},
+			want: Result{float64(6)},
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			reader = bufio.NewReader(strings.NewReader(tc.readerInput))
-			got := choose(en, tc.options)
+			in.Stdin = bufio.NewReader(strings.NewReader(tc.readerInput))
+			got, err := choose(en, tc.options)
+			if err != nil {
+				t.Fatalf("choose(%v) error = %v", tc.options, err)
+			}
 			if !reflect.DeepEqual(got, tc.want) {
 				t.Errorf("choose(%v) = %#v, want %#v", tc.options, got, tc.want)
 			}
 		})
 	}
 }
+
+func TestDef(t *testing.T) {
+	fact := []interface{}{"!def", "fact", []interface{}{"n"},
+		[]interface{}{"!if", []interface{}{"!?eq", []interface{}{"!env", "$n"}, float64(0)}, float64(1),
+			[]interface{}{"!mul", []interface{}{"!env", "$n"}, []interface{}{"!fact", []interface{}{"!sub", []interface{}{"!env", "$n"}, float64(1)}}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		input   interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name: "call",
+			input: []interface{}{
+				[]interface{}{"!def", "twice", []interface{}{"x"}, []interface{}{"!mul", []interface{}{"!env", "$x"}, float64(2)}},
+				[]interface{}{"!twice", float64(3)},
+				[]interface{}{"!twice", []interface{}{"!twice", float64(1)}},
+			},
+			want: []interface{}{float64(6), float64(4)},
+		},
+		{
+			name:  "recursion",
+			input: []interface{}{fact, []interface{}{"!fact", float64(5)}},
+			want:  []interface{}{float64(120)},
+		},
+		{
+			name:  "object form call",
+			input: []interface{}{fact, map[string]interface{}{"!": "fact", "n": float64(3)}},
+			want:  []interface{}{float64(6)},
+		},
+		{
+			name: "object form definition",
+			input: []interface{}{
+				map[string]interface{}{"!": "def", "name": "pair", "params": []interface{}{"a", "b"}, "body": []interface{}{[]interface{}{"!env", "$a"}, []interface{}{"!env", "$b"}}},
+				[]interface{}{"!pair", "x", "y"},
+			},
+			want: []interface{}{[]interface{}{"x", "y"}},
+		},
+		{
+			name: "shadows built-in",
+			input: []interface{}{
+				[]interface{}{"!def", "add", []interface{}{"a", "b"}, "shadowed"},
+				[]interface{}{"!add", float64(1), float64(2)},
+			},
+			want: []interface{}{"shadowed"},
+		},
+		{
+			name: "lexical scope",
+			input: []interface{}{
+				[]interface{}{"!def", "outer", []interface{}{"x"}, []interface{}{"!inner"}},
+				[]interface{}{"!def", "inner", []interface{}{}, []interface{}{"!env", "$x"}},
+				[]interface{}{"!outer", float64(1)},
+			},
+			wantErr: true,
+		},
+		{
+			name: "not visible outside scope",
+			input: []interface{}{
+				[]interface{}{[]interface{}{"!def", "f", []interface{}{}, float64(1)}},
+				[]interface{}{"!f"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate in scope",
+			input: []interface{}{
+				[]interface{}{"!def", "f", []interface{}{}, float64(1)},
+				[]interface{}{"!def", "f", []interface{}{}, float64(2)},
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong number of arguments",
+			input: []interface{}{
+				[]interface{}{"!def", "f", []interface{}{"a"}, float64(1)},
+				[]interface{}{"!f", float64(1), float64(2)},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := New().Fun(tc.input)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Fun(%v) error = %v, wantErr %v", tc.input, err, tc.wantErr)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Fun(%v) = %#v, want %#v", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEnvKey(t *testing.T) {
+	tests := []struct {
+		path      string
+		key, rest string
+	}{
+		{".", ".", ""},
+		{":a.b", ":", "a.b"},
+		{"\\i", "\\", "i"},
+		{"$x", "$x", ""},
+		{"$x.a.b", "$x", "a.b"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			key, rest := envKey(tc.path)
+			if key != tc.key || rest != tc.rest {
+				t.Errorf("envKey(%q) = (%q, %q), want (%q, %q)", tc.path, key, rest, tc.key, tc.rest)
+			}
+		})
+	}
+}
+
+func TestLambda(t *testing.T) {
+	inc := []interface{}{"!fn", []interface{}{"x"}, []interface{}{"!add", []interface{}{"!env", "$x"}, float64(1)}}
+	list := []interface{}{float64(3), float64(1), []interface{}{"!add", float64(1), float64(1)}}
+
+	tests := []struct {
+		name    string
+		input   interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:  "call",
+			input: []interface{}{"!call", inc, float64(1)},
+			want:  float64(2),
+		},
+		{
+			name: "call variable",
+			input: []interface{}{
+				[]interface{}{"!def", "apply", []interface{}{"f", "x"}, []interface{}{"!$f", []interface{}{"!env", "$x"}}},
+				[]interface{}{"!apply", inc, float64(2)},
+			},
+			want: []interface{}{float64(3)},
+		},
+		{
+			name: "closure",
+			input: []interface{}{
+				[]interface{}{"!def", "adder", []interface{}{"n"}, []interface{}{"!fn", []interface{}{"x"}, []interface{}{"!add", []interface{}{"!env", "$x"}, []interface{}{"!env", "$n"}}}},
+				[]interface{}{"!call", []interface{}{"!adder", float64(10)}, float64(5)},
+			},
+			want: []interface{}{float64(15)},
+		},
+		{
+			name:  "map",
+			input: []interface{}{"!map", inc, list},
+			want:  []interface{}{float64(4), float64(2), float64(3)},
+		},
+		{
+			name:    "map result values",
+			input:   []interface{}{"!map", inc, []interface{}{"!split", ",", "a,b"}},
+			wantErr: true,
+		},
+		{
+			name:  "filter",
+			input: []interface{}{"!filter", []interface{}{"!fn", []interface{}{"x"}, []interface{}{"!?eq", []interface{}{"!env", "$x"}, float64(1)}}, list},
+			want:  []interface{}{float64(1)},
+		},
+		{
+			name: "reduce",
+			input: []interface{}{"!reduce",
+				[]interface{}{"!fn", []interface{}{"acc", "x"}, []interface{}{"!add", []interface{}{"!env", "$acc"}, []interface{}{"!env", "$x"}}},
+				float64(10), list},
+			want: float64(16),
+		},
+		{
+			name:  "sortBy",
+			input: []interface{}{"!sortBy", []interface{}{"!fn", []interface{}{"x"}, []interface{}{"!env", "$x.name"}}, []interface{}{map[string]interface{}{"name": "b"}, map[string]interface{}{"name": "a"}}},
+			want:  []interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}},
+		},
+		{
+			name:    "wrong number of arguments",
+			input:   []interface{}{"!call", inc, float64(1), float64(2)},
+			wantErr: true,
+		},
+		{
+			name:    "not a function",
+			input:   []interface{}{"!call", float64(1)},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := New().Fun(tc.input)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Fun(%v) error = %v, wantErr %v", tc.input, err, tc.wantErr)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Fun(%v) = %#v, want %#v", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLambdaResult(t *testing.T) {
+	for _, input := range []interface{}{
+		[]interface{}{"!fn", []interface{}{"x"}, float64(1)},
+		map[string]interface{}{"a": []interface{}{"!fn", []interface{}{}, float64(1)}},
+	} {
+		got, err := New().Fun(input)
+		if err != nil {
+			t.Fatalf("Fun(%v) error = %v", input, err)
+		}
+		if _, err := json.Marshal(got); !errors.As(err, &ErrorFunctionValue{}) {
+			t.Errorf("json.Marshal(Fun(%v)) error = %v, want ErrorFunctionValue", input, err)
+		}
+	}
+}
+
+func TestLetAndVar(t *testing.T) {
+	env := func(path string) []interface{} { return []interface{}{"!env", path} }
+
+	tests := []struct {
+		name    string
+		input   interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:  "let object",
+			input: []interface{}{"!let", map[string]interface{}{"a": float64(1), "b": []interface{}{"!add", float64(1), float64(1)}}, []interface{}{"!add", env("$a"), env("$b")}},
+			want:  float64(3),
+		},
+		{
+			name:  "let pairs",
+			input: []interface{}{"!let", []interface{}{[]interface{}{"a", float64(2)}, []interface{}{"b", []interface{}{"!mul", env("$a"), float64(3)}}}, env("$b")},
+			want:  float64(6),
+		},
+		{
+			name:    "let object values can not see each other",
+			input:   []interface{}{"!let", map[string]interface{}{"a": float64(1), "b": env("$a")}, env("$b")},
+			wantErr: true,
+		},
+		{
+			name:  "let path",
+			input: []interface{}{"!let", map[string]interface{}{"o": map[string]interface{}{"x": "y"}}, []interface{}{env("$o.x"), []interface{}{"!?env", "$o.z"}}},
+			want:  []interface{}{"y", false},
+		},
+		{
+			name:  "let shadows",
+			input: []interface{}{"!let", map[string]interface{}{"a": float64(1)}, []interface{}{"!let", map[string]interface{}{"a": float64(2)}, env("$a")}},
+			want:  float64(2),
+		},
+		{
+			name:  "let object form",
+			input: map[string]interface{}{"!": "let", "bindings": map[string]interface{}{"a": "x"}, "body": map[string]interface{}{"k": env("$a")}},
+			want:  map[string]interface{}{"k": "x"},
+		},
+		{
+			name:    "let not visible outside",
+			input:   []interface{}{[]interface{}{"!let", map[string]interface{}{"a": float64(1)}, env("$a")}, env("$a")},
+			wantErr: true,
+		},
+		{
+			name:    "let invalid name",
+			input:   []interface{}{"!let", map[string]interface{}{"a.b": float64(1)}, float64(1)},
+			wantErr: true,
+		},
+		{
+			name: "var",
+			input: []interface{}{
+				[]interface{}{"!var", "x", float64(1)},
+				env("$x"),
+				[]interface{}{"!var", "x", []interface{}{"!add", env("$x"), float64(1)}},
+				env("$x"),
+			},
+			want: []interface{}{float64(1), float64(2)},
+		},
+		{
+			name: "var in object",
+			input: map[string]interface{}{
+				"a": []interface{}{"!var", "x", float64(1)},
+				"b": env("$x"),
+			},
+			want: map[string]interface{}{"a": nil, "b": float64(1)},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := New().Fun(tc.input)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Fun(%v) error = %v, wantErr %v", tc.input, err, tc.wantErr)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Fun(%v) = %#v, want %#v", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIncludeAndImport(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib")
+	if err := os.Mkdir(lib, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"value.fson":        `{ "a": [ "!add", 1, 2 ] }`,
+		"nested.fson":       `[ "!include", "value.fson" ]`,
+		"defs.fson":         `[ [ "!def", "double", [ "x" ], [ "!mul", [ "!env", "$x" ], 2 ] ], [ "!var", "answer", 42 ] ]`,
+		"cycle.a.fson":      `[ "!include", "cycle.b.fson" ]`,
+		"cycle.b.fson":      `[ "!include", "cycle.a.fson" ]`,
+		"lib/onpath.fson":   `"found on path"`,
+		"lib/relative.fson": `[ "!include", "onpath.fson" ]`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		path    []string
+		input   interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:  "include",
+			input: []interface{}{"!include", "value.fson"},
+			want:  map[string]interface{}{"a": float64(3)},
+		},
+		{
+			name:  "include relative to included file",
+			input: []interface{}{"!include", "lib/relative.fson"},
+			want:  "found on path",
+		},
+		{
+			name:  "include nested",
+			input: []interface{}{"!include", "nested.fson"},
+			want:  map[string]interface{}{"a": float64(3)},
+		},
+		{
+			name:  "include from path",
+			path:  []string{lib},
+			input: []interface{}{"!include", "onpath.fson"},
+			want:  "found on path",
+		},
+		{
+			name:    "include not found",
+			input:   []interface{}{"!include", "onpath.fson"},
+			wantErr: true,
+		},
+		{
+			name:    "include cycle",
+			input:   []interface{}{"!include", "cycle.a.fson"},
+			wantErr: true,
+		},
+		{
+			name: "import",
+			input: []interface{}{
+				[]interface{}{"!import", "defs.fson"},
+				[]interface{}{"!double", []interface{}{"!env", "$answer"}},
+			},
+			want: []interface{}{float64(84)},
+		},
+		{
+			name: "import twice",
+			input: []interface{}{
+				[]interface{}{"!import", "defs.fson"},
+				[]interface{}{"!import", "defs.fson"},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "import not a module",
+			input:   []interface{}{"!import", "nested.fson"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			in := New()
+			in.Path = tc.path
+			got, err := in.FunSource(filepath.Join(dir, "main.fson"), tc.input)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("FunSource(%v) error = %v, wantErr %v", tc.input, err, tc.wantErr)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("FunSource(%v) = %#v, want %#v", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadModuleCycle(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "self.fson")
+	if err := ioutil.WriteFile(file, []byte(`[]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	en := &EnviromentNode{Enviroment: Enviroment{"file": file, "imports": []string{file}}}
+	_, _, err := loadModule(en, "self.fson")
+	want := ErrorImportCycle{Files: []string{file, file}}
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("loadModule(self.fson) error = %v, want %v", err, want)
+	}
+}
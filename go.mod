@@ -1,5 +1,3 @@
 module github.com/jezek/funson
 
-go 1.16
-
-require github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826
+go 1.18
@@ -0,0 +1,166 @@
+package funson
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Interpreter runs funson programs.
+// Every interpreter owns its function registry, clock and I/O, so differently configured interpreters can be used side by side.
+// Programs can be run by one interpreter concurrently, functions can be added while programs run.
+// Fields have to be set before running programs.
+type Interpreter struct {
+	// Now returns the current time for time dependent functions, real time if nil.
+	// FixedClock and OffsetClock return clocks for reproducible runs.
+	Now func() time.Time
+	// Prompter asks questions of interactive functions (input, choose), terminal prompter over Stdin and Stdout if nil.
+	Prompter Prompter
+	// Stdin is read by the default terminal prompter.
+	Stdin *bufio.Reader
+	// Stdout receives questions and messages of the default terminal prompter.
+	Stdout io.Writer
+	// Stderr receives output of print function and of the default logger.
+	Stderr io.Writer
+	// Logger receives messages of log function, which are at least LogLevel. Writer logger over Stderr if nil.
+	Logger Logger
+	// LogLevel is the lowest level of logged messages, LogInfo by default. LogOff silences logging.
+	LogLevel LogLevel
+	// Path lists directories searched for files loaded by import and include functions, after the directory of the loading file.
+	Path []string
+	// Lenient ignores leftover arguments of non-variadic functions instead of failing, as older versions did.
+	Lenient bool
+	// Limits of every program run, no limits by default.
+	Limits Limits
+	// Parallelism is the maximum number of items processed concurrently by parallel function, number of usable CPUs if zero.
+	Parallelism int
+
+	// Guards functions and lines.
+	mu        sync.RWMutex
+	functions map[string]function
+	// Line reader of Stdin, shared by program runs.
+	lines *lineReader
+	// Serializes writes to Stderr.
+	stderrMu sync.Mutex
+}
+
+// Returns new interpreter with all built-in functions registered, reading from standard input and writing to standard output.
+func New() *Interpreter {
+	i := &Interpreter{
+		Now:       time.Now,
+		Stdin:     bufio.NewReader(os.Stdin),
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+		functions: make(map[string]function, len(builtins)),
+	}
+	for name, f := range builtins {
+		i.functions[name] = f
+	}
+	return i
+}
+
+// Adds custom function "fun" to be used as "name" in programs run by this interpreter.
+// See AddFun for the required format of "fun".
+func (i *Interpreter) AddFun(name string, fun interface{}) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return addFun(i.functions, name, fun)
+}
+
+// Returns function registered as "name", or false if there is none.
+func (i *Interpreter) function(name string) (function, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	f, ok := i.functions[name]
+	return f, ok
+}
+
+// Returns prompter of the interpreter.
+func (i *Interpreter) prompter() Prompter {
+	if i.Prompter != nil {
+		return i.Prompter
+	}
+	return &TerminalPrompter{lines: i.stdin(), out: i.Stdout}
+}
+
+// Returns line reader of Stdin.
+func (i *Interpreter) stdin() *lineReader {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.lines == nil || i.lines.r != i.Stdin {
+		i.lines = newLineReader(i.Stdin)
+	}
+	return i.lines
+}
+
+// Runs funson program "in" and returns its result.
+// Errors are returned as *EvalError.
+func (i *Interpreter) Fun(in interface{}) (interface{}, error) {
+	return i.FunContext(context.Background(), in)
+}
+
+// Runs funson program "in" and returns its result.
+// The program is stopped with error, when "ctx" is done.
+func (i *Interpreter) FunContext(ctx context.Context, in interface{}) (interface{}, error) {
+	return i.run(ctx, Enviroment{}, in, nil)
+}
+
+// Runs funson program "in" read from "source" file and returns its result.
+// Files loaded by the program with import and include functions are searched relative to the "source" file.
+func (i *Interpreter) FunSource(source string, in interface{}) (interface{}, error) {
+	return i.FunSourceContext(context.Background(), source, in)
+}
+
+// Runs funson program "in" read from "source" file like FunSource, stopping with error when "ctx" is done.
+func (i *Interpreter) FunSourceContext(ctx context.Context, source string, in interface{}) (interface{}, error) {
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return nil, err
+	}
+	return i.run(ctx, Enviroment{
+		"file":    abs,
+		"imports": []string{abs},
+	}, in, nil)
+}
+
+// Runs program "in" in root enviroment "e", using compiled program "p" if not nil.
+func (i *Interpreter) run(ctx context.Context, e Enviroment, in interface{}, p *Program) (res interface{}, err error) {
+	env := &EnviromentNode{
+		Enviroment:  e,
+		interpreter: i,
+		eval: &evaluation{
+			ctx:      ctx,
+			limits:   i.Limits,
+			steps:    new(int64),
+			program:  p,
+			prompter: i.prompter(),
+		},
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = env.evalError(panicError(r))
+		}
+	}()
+	res, err = env.Process(in)
+	if err == nil {
+		err = env.evalError(env.checkResultSize(res))
+	}
+	return
+}
+
+// Interpreter used by package level Fun and AddFun.
+var defaultInterpreter *Interpreter
+
+// Runs funson program "in" using default interpreter.
+func Fun(in interface{}) (interface{}, error) {
+	return defaultInterpreter.Fun(in)
+}
+
+// Runs funson program "in" using default interpreter, stopping with error when "ctx" is done.
+func FunContext(ctx context.Context, in interface{}) (interface{}, error) {
+	return defaultInterpreter.FunContext(ctx, in)
+}
@@ -0,0 +1,228 @@
+package funson
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	a, b := New(), New()
+	if len(a.functions) != len(builtins) {
+		t.Fatalf("len(New().functions) = %d, want %d", len(a.functions), len(builtins))
+	}
+	for name := range builtins {
+		if _, ok := a.functions[name]; !ok {
+			t.Errorf("built-in function %q missing in new interpreter", name)
+		}
+	}
+
+	if err := a.AddFun("onlyA", func(_ *EnviromentNode) string { return "a" }); err != nil {
+		t.Fatalf("AddFun(onlyA) error = %v", err)
+	}
+	if _, ok := b.functions["onlyA"]; ok {
+		t.Errorf("function added to one interpreter is registered in another")
+	}
+	if _, ok := builtins["onlyA"]; ok {
+		t.Errorf("function added to interpreter is registered in built-ins")
+	}
+}
+
+func TestInterpreterFun(t *testing.T) {
+	a, b := New(), New()
+	if err := a.AddFun("who", func(_ *EnviromentNode) string { return "a" }); err != nil {
+		t.Fatalf("a.AddFun(who) error = %v", err)
+	}
+	if err := b.AddFun("who", func(_ *EnviromentNode) string { return "b" }); err != nil {
+		t.Fatalf("b.AddFun(who) error = %v", err)
+	}
+	fixed := time.Date(2026, time.January, 2, 15, 4, 5, 0, time.UTC)
+	b.Now = func() time.Time { return fixed }
+
+	tests := []struct {
+		name        string
+		interpreter *Interpreter
+		input       interface{}
+		want        interface{}
+		wantErr     bool
+	}{
+		{"own function a", a, []interface{}{"!who"}, "a", false},
+		{"own function b", b, []interface{}{"!who"}, "b", false},
+		{"own clock", b, []interface{}{"!time.Format", []interface{}{"!time.Now"}, time.RFC3339}, "2026-01-02T15:04:05Z", false},
+		{"unknown function", New(), []interface{}{"!who"}, nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.interpreter.Fun(tc.input)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Fun(%v) error = %v, wantErr %v", tc.input, err, tc.wantErr)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Fun(%v) = %#v, want %#v", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInterpreterLenient(t *testing.T) {
+	in := New()
+	input := []interface{}{"!add", float64(1), float64(2), float64(3)}
+
+	_, err := in.Fun(input)
+	want := ErrorArgumentCount{Function: "add", Expected: 2, Received: 3}
+	if !errors.Is(err, want) {
+		t.Errorf("Fun(%v) error = %v, want %v", input, err, want)
+	}
+
+	in.Lenient = true
+	got, err := in.Fun(input)
+	if err != nil || got != float64(3) {
+		t.Errorf("lenient Fun(%v) = (%v, %v), want (%v, %v)", input, got, err, float64(3), nil)
+	}
+}
+
+func TestInterpreterFunContext(t *testing.T) {
+	type ctxKey struct{}
+	in := New()
+	in.Stdout = ioutil.Discard
+	blocked, w := io.Pipe()
+	defer w.Close()
+	in.Stdin = bufio.NewReader(blocked)
+	if err := in.AddFun("ctxValue", func(en *EnviromentNode) (interface{}, error) {
+		return en.Context().Value(ctxKey{}), nil
+	}); err != nil {
+		t.Fatalf("AddFun(ctxValue) error = %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		input   interface{}
+		want    interface{}
+		wantErr error
+	}{
+		{
+			name: "value in function",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithValue(context.Background(), ctxKey{}, "value"), func() {}
+			},
+			input: []interface{}{"!ctxValue"},
+			want:  "value",
+		},
+		{
+			name:    "canceled before run",
+			ctx:     func() (context.Context, context.CancelFunc) { return canceled, func() {} },
+			input:   []interface{}{"!add", float64(1), float64(2)},
+			wantErr: context.Canceled,
+		},
+		{
+			name: "endless for",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+			input:   []interface{}{"!for", []interface{}{"!?eq", float64(1), float64(1)}},
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "blocked input",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+			input:   []interface{}{"!input", map[string]interface{}{}},
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "blocked choose",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+			input:   []interface{}{"!choose", map[string]interface{}{"options": []interface{}{"a", "b"}}},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := tc.ctx()
+			defer cancel()
+			got, err := in.FunContext(ctx, tc.input)
+			if tc.wantErr != nil {
+				var evalErr *EvalError
+				if !errors.Is(err, tc.wantErr) || !errors.As(err, &evalErr) {
+					t.Fatalf("FunContext(%v) error = %v, want *EvalError wrapping %v", tc.input, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("FunContext(%v) = (%#v, %v), want (%#v, nil)", tc.input, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestInterpreterConcurrent(t *testing.T) {
+	const runs = 20
+	in := New()
+	in.Stdout = ioutil.Discard
+	in.Stdin = bufio.NewReader(strings.NewReader(strings.Repeat("2\n", 2*runs)))
+
+	interactive := []interface{}{
+		[]interface{}{"!input", map[string]interface{}{"type": "float", "question": "Amount"}},
+		[]interface{}{"!choose", map[string]interface{}{"options": []interface{}{"a", "b"}}},
+	}
+	loop := []interface{}{[]interface{}{"!for", []interface{}{"!not", []interface{}{"!?eq", []interface{}{"!env", "\\i"}, float64(3)}}, []interface{}{"!env", "\\i"}}}
+	program, err := in.Compile(loop)
+	if err != nil {
+		t.Fatalf("Compile(%v) error = %v", loop, err)
+	}
+
+	tests := []struct {
+		name string
+		run  func() (interface{}, error)
+		want interface{}
+	}{
+		{"input and choose", func() (interface{}, error) { return in.Fun(interactive) }, []interface{}{float64(2), "b"}},
+		{"for", func() (interface{}, error) { return in.Fun(loop) }, []interface{}{float64(0), float64(1), float64(2)}},
+		{"compiled for", program.Run, []interface{}{float64(0), float64(1), float64(2)}},
+	}
+
+	var wg sync.WaitGroup
+	for _, tc := range tests {
+		for r := 0; r < runs; r++ {
+			wg.Add(1)
+			go func(name string, run func() (interface{}, error), want interface{}) {
+				defer wg.Done()
+				if got, err := run(); err != nil || !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = (%#v, %v), want (%#v, nil)", name, got, err, want)
+				}
+			}(tc.name, tc.run, tc.want)
+		}
+	}
+	for r := 0; r < runs; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			name := fmt.Sprintf("added%d", r)
+			if err := in.AddFun(name, func(_ *EnviromentNode) float64 { return float64(r) }); err != nil {
+				t.Errorf("AddFun(%s) error = %v", name, err)
+				return
+			}
+			if got, err := in.Fun([]interface{}{"!" + name}); err != nil || got != float64(r) {
+				t.Errorf("Fun(!%s) = (%#v, %v), want (%v, nil)", name, got, err, r)
+			}
+		}(r)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,122 @@
+package funson
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+)
+
+// Limits of one program run. Zero value of a limit means no limit.
+type Limits struct {
+	// Maximum number of processed program nodes.
+	Steps int
+	// Maximum depth of nested function calls. Depth is always limited to maxDepth, zero or greater limit means maxDepth.
+	Depth int
+	// Maximum number of iterations of one loop.
+	Iterations int
+	// Maximum number of values in program result, every array, object and leaf value counts as one.
+	ResultSize int
+}
+
+// Maximum depth of nested function calls of any program run, so runaway recursion fails with ErrorDepthLimit before it overflows the stack.
+const maxDepth = 2000
+
+type ErrorStepLimit struct{ Limit int }
+
+func (e ErrorStepLimit) Error() string {
+	return fmt.Sprintf("step limit %d exceeded", e.Limit)
+}
+
+type ErrorDepthLimit struct{ Limit int }
+
+func (e ErrorDepthLimit) Error() string {
+	return fmt.Sprintf("function call depth limit %d exceeded", e.Limit)
+}
+
+type ErrorIterationLimit struct{ Limit int }
+
+func (e ErrorIterationLimit) Error() string {
+	return fmt.Sprintf("loop iteration limit %d exceeded", e.Limit)
+}
+
+type ErrorResultSizeLimit struct{ Limit int }
+
+func (e ErrorResultSizeLimit) Error() string {
+	return fmt.Sprintf("result size limit %d values exceeded", e.Limit)
+}
+
+// Returns limits of the program run.
+func (en *EnviromentNode) limits() Limits {
+	if en == nil || en.eval == nil {
+		return Limits{}
+	}
+	return en.eval.limits
+}
+
+// Returns error if the program run can't continue with processing of next node.
+func (en *EnviromentNode) step() error {
+	if err := en.Context().Err(); err != nil {
+		return err
+	}
+	if limit := en.limits().Steps; limit > 0 && atomic.AddInt64(en.eval.steps, 1) > int64(limit) {
+		return ErrorStepLimit{Limit: limit}
+	}
+	return nil
+}
+
+// Returns error if function calls in enviroment are nested too deep.
+func (en *EnviromentNode) checkDepth() error {
+	limit := en.limits().Depth
+	if limit <= 0 || limit > maxDepth {
+		limit = maxDepth
+	}
+	if len(en.stack) > limit {
+		return ErrorDepthLimit{Limit: limit}
+	}
+	return nil
+}
+
+// Returns error if loop can't continue with iteration "i" (counted from 0).
+func (en *EnviromentNode) iteration(i int) error {
+	if err := en.Context().Err(); err != nil {
+		return err
+	}
+	if limit := en.limits().Iterations; limit > 0 && i >= limit {
+		return ErrorIterationLimit{Limit: limit}
+	}
+	return nil
+}
+
+// Returns error if result "res" has more values than allowed.
+func (en *EnviromentNode) checkResultSize(res interface{}) error {
+	limit := en.limits().ResultSize
+	if limit <= 0 {
+		return nil
+	}
+	if resultSize(res, limit) > limit {
+		return ErrorResultSizeLimit{Limit: limit}
+	}
+	return nil
+}
+
+// Returns number of values in "v", counting stops when "limit" is exceeded.
+func resultSize(v interface{}, limit int) int {
+	size := 1
+	if _, ok := v.(Result); ok {
+		// Result is not a value, only its items are.
+		size = 0
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < rv.Len() && size <= limit; i++ {
+			size += resultSize(rv.Index(i).Interface(), limit-size)
+		}
+	case reflect.Map:
+		iter := rv.MapRange()
+		for size <= limit && iter.Next() {
+			size += resultSize(iter.Value().Interface(), limit-size)
+		}
+	}
+	return size
+}
@@ -0,0 +1,138 @@
+package funson
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	recursive := []interface{}{
+		[]interface{}{"!def", "f", []interface{}{}, []interface{}{"!f"}},
+		[]interface{}{"!f"},
+	}
+	endless := []interface{}{"!for", []interface{}{"!?eq", float64(1), float64(1)}, "x"}
+	counted := []interface{}{"!for", []interface{}{"!?eq", []interface{}{"!env", "\\i"}, float64(0)}, "x"}
+
+	tests := []struct {
+		name    string
+		limits  Limits
+		input   interface{}
+		want    interface{}
+		wantErr error
+	}{
+		{
+			name:   "no limits",
+			limits: Limits{},
+			input:  counted,
+			want:   "x",
+		},
+		{
+			name:    "steps",
+			limits:  Limits{Steps: 100},
+			input:   endless,
+			wantErr: ErrorStepLimit{Limit: 100},
+		},
+		{
+			name:   "steps within limit",
+			limits: Limits{Steps: 2},
+			input:  []interface{}{"!add", float64(1), []interface{}{"!add", float64(1), float64(1)}},
+			want:   float64(3),
+		},
+		{
+			name:    "steps exceeded",
+			limits:  Limits{Steps: 1},
+			input:   []interface{}{"!add", float64(1), []interface{}{"!add", float64(1), float64(1)}},
+			wantErr: ErrorStepLimit{Limit: 1},
+		},
+		{
+			name:    "depth",
+			limits:  Limits{Depth: 50},
+			input:   recursive,
+			wantErr: ErrorDepthLimit{Limit: 50},
+		},
+		{
+			name:    "depth object form",
+			limits:  Limits{Depth: 1},
+			input:   []interface{}{"!add", float64(1), map[string]interface{}{"!": "add", "a": float64(1), "b": float64(1)}},
+			wantErr: ErrorDepthLimit{Limit: 1},
+		},
+		{
+			name:    "depth without limit",
+			limits:  Limits{},
+			input:   recursive,
+			wantErr: ErrorDepthLimit{Limit: maxDepth},
+		},
+		{
+			name:    "depth over maximum",
+			limits:  Limits{Depth: maxDepth * 10},
+			input:   recursive,
+			wantErr: ErrorDepthLimit{Limit: maxDepth},
+		},
+		{
+			name:    "iterations",
+			limits:  Limits{Iterations: 10},
+			input:   endless,
+			wantErr: ErrorIterationLimit{Limit: 10},
+		},
+		{
+			name:   "iterations within limit",
+			limits: Limits{Iterations: 1},
+			input:  counted,
+			want:   "x",
+		},
+		{
+			name:   "result size within limit",
+			limits: Limits{ResultSize: 4},
+			input:  map[string]interface{}{"a": []interface{}{float64(1), float64(2)}},
+			want:   map[string]interface{}{"a": []interface{}{float64(1), float64(2)}},
+		},
+		{
+			name:    "result size exceeded",
+			limits:  Limits{ResultSize: 3},
+			input:   map[string]interface{}{"a": []interface{}{float64(1), float64(2)}},
+			wantErr: ErrorResultSizeLimit{Limit: 3},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			in := New()
+			in.Limits = tc.limits
+			got, err := in.Fun(tc.input)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("Fun(%v) error = %v, want %v", tc.input, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Fun(%v) = (%#v, %v), want (%#v, nil)", tc.input, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestResultSize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input interface{}
+		limit int
+		want  int
+	}{
+		{"leaf", "a", 10, 1},
+		{"array", []interface{}{"a", float64(1)}, 10, 3},
+		{"object", map[string]interface{}{"a": []interface{}{"b"}, "c": nil}, 10, 4},
+		{"result", Result{"a", "b"}, 10, 2},
+		{"typed slice", []string{"a", "b"}, 10, 3},
+		{"stops over limit", []interface{}{"a", "b", "c", "d"}, 1, 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := resultSize(tc.input, tc.limit); got != tc.want {
+				t.Errorf("resultSize(%v, %d) = %d, want %d", tc.input, tc.limit, got, tc.want)
+			}
+		})
+	}
+}
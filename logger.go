@@ -0,0 +1,168 @@
+package funson
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Level of logged message.
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota - 1
+	LogInfo
+	LogWarn
+	LogError
+	// Level of interpreter, which logs nothing.
+	LogOff
+)
+
+var logLevelNames = map[LogLevel]string{
+	LogDebug: "debug",
+	LogInfo:  "info",
+	LogWarn:  "warn",
+	LogError: "error",
+	LogOff:   "off",
+}
+
+func (l LogLevel) String() string {
+	if name, ok := logLevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+type ErrorUnknownLogLevel struct{ Level string }
+
+func (e ErrorUnknownLogLevel) Error() string {
+	return fmt.Sprintf("unknown log level %q, want one of debug, info, warn, error, off", e.Level)
+}
+
+// Returns log level named "name" (debug, info, warn, error, off).
+func ParseLogLevel(name string) (LogLevel, error) {
+	for l, n := range logLevelNames {
+		if n == name {
+			return l, nil
+		}
+	}
+	return 0, ErrorUnknownLogLevel{Level: name}
+}
+
+// Logger receives messages of log function, which pass LogLevel of the interpreter.
+// It is called concurrently by concurrent program runs.
+type Logger interface {
+	Log(level LogLevel, msg string)
+}
+
+// Logger writing messages as lines prefixed by their level to writer.
+type WriterLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Returns logger writing messages to "w".
+func NewWriterLogger(w io.Writer) *WriterLogger {
+	return &WriterLogger{w: w}
+}
+
+func (l *WriterLogger) Log(level LogLevel, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.w, "%s: %s\n", strings.ToUpper(level.String()), msg)
+}
+
+// Logs message "msg" at "level" by Logger of the interpreter, if the level is at least interpreter's LogLevel.
+func (en *EnviromentNode) Log(level LogLevel, msg string) {
+	i := en.Interpreter()
+	if level < i.LogLevel || level >= LogOff {
+		return
+	}
+	if i.Logger != nil {
+		i.Logger.Log(level, msg)
+		return
+	}
+	i.writeStderr(strings.ToUpper(level.String()) + ": " + msg + "\n")
+}
+
+// Writes "s" to Stderr of the interpreter, standard error if it is nil.
+func (i *Interpreter) writeStderr(s string) error {
+	w := i.Stderr
+	if w == nil {
+		w = os.Stderr
+	}
+	i.stderrMu.Lock()
+	defer i.stderrMu.Unlock()
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+// Returns "values" processed in enviroment "en", multiple results are spread.
+func processValues(en *EnviromentNode, values []interface{}) ([]interface{}, error) {
+	out := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		pv, err := en.Process(v)
+		if err != nil {
+			return nil, err
+		}
+		if r, ok := pv.(Result); ok {
+			out = append(out, r...)
+			continue
+		}
+		out = append(out, pv)
+	}
+	return out, nil
+}
+
+func printValues(en *EnviromentNode, values ...interface{}) (string, error) {
+	pvs, err := processValues(en, values)
+	if err != nil {
+		return "", err
+	}
+	lines := make([]string, len(pvs))
+	for i, v := range pvs {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		lines[i] = string(b)
+	}
+	s := strings.Join(lines, "\n")
+	if err := en.Interpreter().writeStderr(s + "\n"); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+func logValues(en *EnviromentNode, level string, values ...interface{}) (Result, error) {
+	l, err := ParseLogLevel(level)
+	if err != nil || l == LogOff {
+		return nil, ErrorUnknownLogLevel{Level: level}
+	}
+	i := en.Interpreter()
+	if l < i.LogLevel || i.LogLevel >= LogOff {
+		// Values are not processed, if the message would not be logged.
+		return Result{}, nil
+	}
+	pvs, err := processValues(en, values)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]string, len(pvs))
+	for i, v := range pvs {
+		if s, ok := v.(string); ok {
+			parts[i] = s
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = string(b)
+	}
+	en.Log(l, strings.Join(parts, " "))
+	return Result{}, nil
+}
@@ -0,0 +1,120 @@
+package funson
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// Logger recording logged messages.
+type recordingLogger struct {
+	levels   []LogLevel
+	messages []string
+}
+
+func (l *recordingLogger) Log(level LogLevel, msg string) {
+	l.levels = append(l.levels, level)
+	l.messages = append(l.messages, msg)
+}
+
+func TestPrint(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{"nothing", []interface{}{"!print"}, "", false},
+		{"values", []interface{}{"!print", "a", float64(1), []interface{}{"!not", true, false}, map[string]interface{}{"b": nil}}, "\"a\"\n1\nfalse\ntrue\n{\"b\":null}", false},
+		{"error", []interface{}{"!print", []interface{}{"!nope"}}, nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stderr := &bytes.Buffer{}
+			in := New()
+			in.Stderr = stderr
+			got, err := in.Fun(tc.input)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Fun(%v) error = %v, wantErr %v", tc.input, err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Fun(%v) = %#v, want %#v", tc.input, got, tc.want)
+			}
+			if want := tc.want.(string) + "\n"; stderr.String() != want {
+				t.Errorf("stderr = %q, want %q", stderr.String(), want)
+			}
+		})
+	}
+}
+
+func TestLog(t *testing.T) {
+	program := []interface{}{
+		[]interface{}{"!log", "debug", "d", []interface{}{"!nope"}},
+		[]interface{}{"!log", "info", "count", float64(2), []interface{}{"a"}},
+		map[string]interface{}{"!": "log", "level": "warn", "values": []interface{}{"w"}},
+		[]interface{}{"!log", "error", "e"},
+		"result",
+	}
+	tests := []struct {
+		name         string
+		level        LogLevel
+		wantLevels   []LogLevel
+		wantMessages []string
+		wantErr      bool
+	}{
+		{"default", LogInfo, []LogLevel{LogInfo, LogWarn, LogError}, []string{"count 2 [\"a\"]", "w", "e"}, false},
+		{"warn", LogWarn, []LogLevel{LogWarn, LogError}, []string{"w", "e"}, false},
+		{"off", LogOff, nil, nil, false},
+		{"debug", LogDebug, nil, nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l := &recordingLogger{}
+			in := New()
+			in.Logger = l
+			in.LogLevel = tc.level
+			got, err := in.Fun(program)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Fun() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if want := []interface{}{"result"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("Fun() = %#v, want %#v", got, want)
+			}
+			if !reflect.DeepEqual(l.levels, tc.wantLevels) || !reflect.DeepEqual(l.messages, tc.wantMessages) {
+				t.Errorf("logged (%v, %q), want (%v, %q)", l.levels, l.messages, tc.wantLevels, tc.wantMessages)
+			}
+		})
+	}
+
+	stderr := &bytes.Buffer{}
+	in := New()
+	in.Stderr = stderr
+	if _, err := in.Fun([]interface{}{"!log", "warn", "to", "stderr"}); err != nil {
+		t.Fatalf("Fun() error = %v", err)
+	}
+	if want := "WARN: to stderr\n"; stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+	if _, err := in.Fun([]interface{}{"!log", "loud", "x"}); err == nil {
+		t.Errorf("Fun(log loud) error = nil, want ErrorUnknownLogLevel")
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for _, l := range []LogLevel{LogDebug, LogInfo, LogWarn, LogError, LogOff} {
+		if got, err := ParseLogLevel(l.String()); err != nil || got != l {
+			t.Errorf("ParseLogLevel(%q) = (%v, %v), want (%v, nil)", l.String(), got, err, l)
+		}
+	}
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Errorf("ParseLogLevel(verbose) error = nil, want error")
+	}
+}
@@ -0,0 +1,118 @@
+package funson
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+type ErrorParallelInteractive struct{ Function string }
+
+func (e ErrorParallelInteractive) Error() string {
+	return fmt.Sprintf("interactive function %s can't be used in parallel function", e.Function)
+}
+
+// Returns error if interactive function can't be called in enviroment.
+func (en *EnviromentNode) interactive() error {
+	if en == nil || en.eval == nil || !en.eval.parallel {
+		return nil
+	}
+	name := ""
+	if len(en.stack) > 0 {
+		name = en.stack[len(en.stack)-1].Function
+	}
+	return ErrorParallelInteractive{Function: name}
+}
+
+// Processes "items" concurrently and returns their results in order of items, like array would.
+// At most interpreter's Parallelism items are processed at once. The first error stops processing of the other items and is returned.
+// Every item is processed in own enviroment, so names bound by def and var in one item are not visible to others.
+func parallel(en *EnviromentNode, items ...interface{}) ([]interface{}, error) {
+	if len(items) == 0 {
+		return []interface{}{}, nil
+	}
+	workers := en.Interpreter().Parallelism
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	ctx, cancel := context.WithCancel(en.Context())
+	defer cancel()
+	eval := evaluation{steps: new(int64)}
+	if en.eval != nil {
+		eval = *en.eval
+	}
+	eval.ctx = ctx
+	eval.parallel = true
+
+	results := make([]interface{}, len(items))
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	indexes := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				item := en.Child(Enviroment{
+					"type": "parallel",
+				})
+				item.eval = &eval
+				res, err := item.processParallel(items[i])
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					mu.Unlock()
+					continue
+				}
+				results[i] = res
+			}
+		}()
+	}
+send:
+	for i := range items {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, 0, len(results))
+	for _, ri := range results {
+		if r, ok := ri.(Result); ok {
+			out = append(out, r...)
+			continue
+		}
+		out = append(out, ri)
+	}
+	return out, nil
+}
+
+// Processes item "in" of parallel function, panic is returned as error, so it doesn't crash the program from another goroutine.
+func (en *EnviromentNode) processParallel(in interface{}) (res interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = en.evalError(panicError(r))
+		}
+	}()
+	return en.Process(in)
+}
@@ -0,0 +1,148 @@
+package funson
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParallel(t *testing.T) {
+	errTest := errors.New("test error")
+	in := New()
+	in.Stdout = ioutil.Discard
+	in.Parallelism = 3
+
+	var (
+		mu           sync.Mutex
+		running, max int
+	)
+	if err := in.AddFun("slow", func(en *EnviromentNode, v float64) (float64, error) {
+		mu.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+		// Later items finish first, so the order of results doesn't come from order of finishing.
+		select {
+		case <-time.After(time.Duration(10-v) * time.Millisecond):
+			return v, nil
+		case <-en.Context().Done():
+			return 0, en.Context().Err()
+		}
+	}); err != nil {
+		t.Fatalf("AddFun(slow) error = %v", err)
+	}
+	if err := in.AddFun("fail", func(_ *EnviromentNode) (string, error) {
+		return "", errTest
+	}); err != nil {
+		t.Fatalf("AddFun(fail) error = %v", err)
+	}
+	if err := in.AddFun("block", func(en *EnviromentNode) (string, error) {
+		<-en.Context().Done()
+		return "", en.Context().Err()
+	}); err != nil {
+		t.Fatalf("AddFun(block) error = %v", err)
+	}
+
+	slow := func(v float64) interface{} { return []interface{}{"!slow", v} }
+	tests := []struct {
+		name    string
+		input   interface{}
+		want    interface{}
+		wantErr error
+	}{
+		{
+			name:  "empty",
+			input: []interface{}{"!parallel"},
+			want:  []interface{}{},
+		},
+		{
+			name:  "keeps order",
+			input: []interface{}{"!parallel", slow(1), slow(2), slow(3), slow(4), slow(5), slow(6), float64(7)},
+			want:  []interface{}{float64(1), float64(2), float64(3), float64(4), float64(5), float64(6), float64(7)},
+		},
+		{
+			name:  "spreads results",
+			input: []interface{}{"!parallel", []interface{}{"!not", true, false}, []interface{}{"!comment"}, "a"},
+			want:  []interface{}{false, true, "a"},
+		},
+		{
+			name: "object form",
+			input: map[string]interface{}{"!": "parallel", "items": []interface{}{
+				[]interface{}{"!add", float64(1), float64(2)},
+				[]interface{}{float64(1), []interface{}{"!mul", float64(2), float64(3)}},
+			}},
+			want: []interface{}{float64(3), []interface{}{float64(1), float64(6)}},
+		},
+		{
+			name: "own scope",
+			input: []interface{}{
+				[]interface{}{"!var", "x", float64(1)},
+				[]interface{}{"!parallel",
+					[]interface{}{[]interface{}{"!var", "x", float64(2)}, []interface{}{"!env", "$x"}},
+					[]interface{}{"!env", "$x"},
+				},
+				[]interface{}{"!env", "$x"},
+			},
+			want: []interface{}{[]interface{}{[]interface{}{float64(2)}, float64(1)}, float64(1)},
+		},
+		{
+			name:    "first error cancels others",
+			input:   []interface{}{"!parallel", []interface{}{"!block"}, []interface{}{"!block"}, []interface{}{"!fail"}, []interface{}{"!block"}},
+			wantErr: errTest,
+		},
+		{
+			name:    "interactive",
+			input:   []interface{}{"!parallel", []interface{}{"!input", map[string]interface{}{}}},
+			wantErr: ErrorParallelInteractive{Function: "input"},
+		},
+		{
+			name: "interactive in function",
+			input: []interface{}{
+				[]interface{}{"!def", "ask", []interface{}{}, []interface{}{"!choose", map[string]interface{}{"options": []interface{}{"a"}}}},
+				[]interface{}{"!parallel", []interface{}{"!ask"}},
+			},
+			wantErr: ErrorParallelInteractive{Function: "choose"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := in.Fun(tc.input)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("Fun(%v) error = %v, want %v", tc.input, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Fun(%v) = (%#v, %v), want (%#v, nil)", tc.input, got, err, tc.want)
+			}
+		})
+	}
+
+	if max > in.Parallelism {
+		t.Errorf("%d items processed at once, want at most %d", max, in.Parallelism)
+	}
+}
+
+func TestParallelLimits(t *testing.T) {
+	in := New()
+	in.Limits = Limits{Steps: 10}
+	items := []interface{}{"!parallel"}
+	for i := 0; i < 10; i++ {
+		items = append(items, []interface{}{"!add", float64(i), float64(1)})
+	}
+	if _, err := in.Fun(items); !errors.Is(err, ErrorStepLimit{Limit: 10}) {
+		t.Errorf("Fun(%v) error = %v, want %v", items, err, ErrorStepLimit{Limit: 10})
+	}
+}
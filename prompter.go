@@ -0,0 +1,134 @@
+package funson
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+)
+
+// Question asked by interactive function.
+type Question struct {
+	// Identifier of the question from "id" option of the function. Empty if there is none.
+	ID string `json:"id,omitempty"`
+	// Text of the question.
+	Text string `json:"text"`
+	// Answer used by the function, if the answer is empty. Empty if there is none.
+	Predefined string `json:"predefined,omitempty"`
+	// Texts of options, if the question is a choice.
+	Options []string `json:"options,omitempty"`
+}
+
+// Prompter asks user questions of interactive functions (input, choose).
+// Answers are validated by the functions, which ask again after showing a message, if the answer is not valid.
+// Methods should return error when "ctx" is done.
+type Prompter interface {
+	// Returns answer to question "q".
+	Ask(ctx context.Context, q Question) (string, error)
+	// Returns answer to choice question "q", which is number of chosen option counted from 1, or empty if none was chosen.
+	AskChoice(ctx context.Context, q Question) (string, error)
+	// Shows message "msg" to user, e.g. why the answer was not accepted.
+	Show(ctx context.Context, msg string) error
+}
+
+// Prompter writing questions to a writer and reading answers as lines from a reader.
+// It is the default prompter of interpreter, over its Stdin and Stdout.
+type TerminalPrompter struct {
+	lines *lineReader
+	out   io.Writer
+}
+
+// Returns terminal prompter reading answers from "in" and writing questions to "out".
+func NewTerminalPrompter(in io.Reader, out io.Writer) *TerminalPrompter {
+	br, ok := in.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(in)
+	}
+	return &TerminalPrompter{lines: newLineReader(br), out: out}
+}
+
+func (p *TerminalPrompter) Ask(ctx context.Context, q Question) (string, error) {
+	text := q.Text
+	if q.Predefined != "" {
+		text += " [" + q.Predefined + "]"
+	}
+	fmt.Fprintf(p.out, "\n%s: ", text)
+	return p.lines.readLine(ctx)
+}
+
+func (p *TerminalPrompter) AskChoice(ctx context.Context, q Question) (string, error) {
+	fmt.Fprintf(p.out, "\nOptions:\n")
+	for i, option := range q.Options {
+		fmt.Fprintf(p.out, "%d) %s\n", i+1, option)
+	}
+	fmt.Fprintf(p.out, "%s: ", q.Text)
+	return p.lines.readLine(ctx)
+}
+
+func (p *TerminalPrompter) Show(_ context.Context, msg string) error {
+	_, err := fmt.Fprintln(p.out, msg)
+	return err
+}
+
+// Reads lines for interactive functions.
+// Lines are read one at a time, line of read stopped by context is returned by the next read, so no line is lost.
+type lineReader struct {
+	r *bufio.Reader
+	// Holds token of read in progress.
+	turn chan struct{}
+	// Line being read in background, nil if none.
+	pending chan readLineResult
+}
+
+// Line read by lineReader in background.
+type readLineResult struct {
+	line string
+	err  error
+}
+
+func newLineReader(r *bufio.Reader) *lineReader {
+	return &lineReader{r: r, turn: make(chan struct{}, 1)}
+}
+
+// Returns next line, or error if "ctx" is done before the line is read.
+// Returns error of the reader (e.g. io.EOF), if there are no more lines.
+func (l *lineReader) readLine(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	select {
+	case l.turn <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-l.turn }()
+
+	if l.pending == nil {
+		if ctx.Done() == nil {
+			return l.read()
+		}
+		// The reading goroutine can't be interrupted, it finishes when the reader returns.
+		pending := make(chan readLineResult, 1)
+		go func() {
+			line, err := l.read()
+			pending <- readLineResult{line, err}
+		}()
+		l.pending = pending
+	}
+	select {
+	case r := <-l.pending:
+		l.pending = nil
+		return r.line, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Returns next line of the reader. Error is returned only if no line is read, last line without line end is returned without error.
+func (l *lineReader) read() (string, error) {
+	line, err := l.r.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return line, nil
+}
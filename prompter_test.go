@@ -0,0 +1,166 @@
+package funson
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Prompter answering questions from list, recording questions and messages.
+type scriptedPrompter struct {
+	answers   []string
+	questions []Question
+	messages  []string
+}
+
+func (p *scriptedPrompter) answer(q Question) (string, error) {
+	p.questions = append(p.questions, q)
+	if len(p.answers) == 0 {
+		return "", errors.New("no answer left")
+	}
+	a := p.answers[0]
+	p.answers = p.answers[1:]
+	return a, nil
+}
+
+func (p *scriptedPrompter) Ask(_ context.Context, q Question) (string, error) {
+	return p.answer(q)
+}
+
+func (p *scriptedPrompter) AskChoice(_ context.Context, q Question) (string, error) {
+	return p.answer(q)
+}
+
+func (p *scriptedPrompter) Show(_ context.Context, msg string) error {
+	p.messages = append(p.messages, msg)
+	return nil
+}
+
+func TestPrompter(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         interface{}
+		answers       []string
+		want          interface{}
+		wantQuestions []Question
+		wantMessages  []string
+		wantErr       bool
+	}{
+		{
+			name:          "input",
+			input:         []interface{}{"!input", map[string]interface{}{"question": "Name", "predefined": "x"}},
+			answers:       []string{""},
+			want:          "x",
+			wantQuestions: []Question{{Text: "Name", Predefined: "x"}},
+		},
+		{
+			name:    "input validated",
+			input:   []interface{}{"!input", map[string]interface{}{"type": "integer", "validator": "^[0-9]+$", "condition": "Digits only"}},
+			answers: []string{"a1", " 12 "},
+			want:    12,
+			wantQuestions: []Question{
+				{Text: "Enter input"},
+				{Text: "Enter input"},
+			},
+			wantMessages: []string{"Entered value doesn't pass condition.\nDigits only"},
+		},
+		{
+			name:    "choose validated",
+			input:   []interface{}{"!choose", map[string]interface{}{"question": "Pick", "options": []interface{}{"a", "b"}}},
+			answers: []string{"", "x", "3", "2"},
+			want:    "b",
+			wantQuestions: []Question{
+				{Text: "Pick", Options: []string{"a", "b"}},
+				{Text: "Pick", Options: []string{"a", "b"}},
+				{Text: "Pick", Options: []string{"a", "b"}},
+				{Text: "Pick", Options: []string{"a", "b"}},
+			},
+			wantMessages: []string{"You have to choose some option", "Choose by entering option number", "Choose a number from list."},
+		},
+		{
+			name:          "prompter error",
+			input:         []interface{}{"!input", map[string]interface{}{}},
+			wantQuestions: []Question{{Text: "Enter input"}},
+			wantErr:       true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &scriptedPrompter{answers: tc.answers}
+			in := New()
+			in.Prompter = p
+			got, err := in.Fun(tc.input)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Fun(%v) error = %v, wantErr %v", tc.input, err, tc.wantErr)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Fun(%v) = %#v, want %#v", tc.input, got, tc.want)
+			}
+			if !reflect.DeepEqual(p.questions, tc.wantQuestions) {
+				t.Errorf("questions = %#v, want %#v", p.questions, tc.wantQuestions)
+			}
+			if !reflect.DeepEqual(p.messages, tc.wantMessages) {
+				t.Errorf("messages = %#v, want %#v", p.messages, tc.wantMessages)
+			}
+		})
+	}
+}
+
+func TestTerminalPrompter(t *testing.T) {
+	out := &bytes.Buffer{}
+	p := NewTerminalPrompter(strings.NewReader("one\ntwo\n"), out)
+	ctx := context.Background()
+
+	if got, err := p.Ask(ctx, Question{Text: "Name", Predefined: "x"}); err != nil || got != "one\n" {
+		t.Errorf("Ask() = (%q, %v), want (%q, nil)", got, err, "one\n")
+	}
+	if got, err := p.AskChoice(ctx, Question{Text: "Pick", Options: []string{"a", "b"}}); err != nil || got != "two\n" {
+		t.Errorf("AskChoice() = (%q, %v), want (%q, nil)", got, err, "two\n")
+	}
+	if err := p.Show(ctx, "Wrong"); err != nil {
+		t.Errorf("Show() error = %v", err)
+	}
+	want := "\nName [x]: " + "\nOptions:\n1) a\n2) b\nPick: " + "Wrong\n"
+	if got := out.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestTerminalPrompterEOF(t *testing.T) {
+	p := NewTerminalPrompter(strings.NewReader("last"), &bytes.Buffer{})
+	ctx := context.Background()
+	if got, err := p.Ask(ctx, Question{Text: "Name"}); err != nil || got != "last" {
+		t.Errorf("Ask() = (%q, %v), want (%q, nil)", got, err, "last")
+	}
+	if got, err := p.Ask(ctx, Question{Text: "Name"}); err != io.EOF {
+		t.Errorf("Ask() = (%q, %v), want (\"\", %v)", got, err, io.EOF)
+	}
+
+	tests := []struct {
+		name  string
+		input interface{}
+	}{
+		{"choose", []interface{}{"!choose", map[string]interface{}{"question": "Pick", "options": []interface{}{"a", "b"}}}},
+		{"input", []interface{}{"!input", map[string]interface{}{"question": "Age", "type": "integer"}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			in := New()
+			in.Stdin = bufio.NewReader(strings.NewReader(""))
+			in.Stdout = ioutil.Discard
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if _, err := in.FunContext(ctx, tc.input); !errors.Is(err, io.EOF) {
+				t.Errorf("FunContext(%v) error = %v, want %v", tc.input, err, io.EOF)
+			}
+		})
+	}
+}
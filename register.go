@@ -0,0 +1,197 @@
+package funson
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Calls registered function "name" with arguments taken from "q", without reflection.
+// Added by RegisterN functions, nil for functions added by AddFun.
+type adapter func(name string, q *argQueue) (Result, error)
+
+// Adds typed function "fun" to be used as "name" in programs run by interpreter "i", or by package level Fun if "i" is nil.
+// Arguments are passed to "fun" without reflection, values of other types are converted like for functions added by AddFun.
+// Non nil error result fails the program, Result is spread to multiple results.
+// Optional "params" name the arguments for object form calls.
+func Register0[R any](i *Interpreter, name string, fun func(*EnviromentNode) (R, error), params ...string) error {
+	if fun == nil {
+		return ErrorNilFunction{}
+	}
+	return i.register(name, fun, func(name string, q *argQueue) (Result, error) {
+		if err := q.leftover(name, 0); err != nil {
+			return nil, err
+		}
+		return typedResult(fun(q.e))
+	}, params)
+}
+
+// Adds typed function "fun" with one argument, see Register0.
+func Register1[A, R any](i *Interpreter, name string, fun func(*EnviromentNode, A) (R, error), params ...string) error {
+	if fun == nil {
+		return ErrorNilFunction{}
+	}
+	return i.register(name, fun, func(name string, q *argQueue) (Result, error) {
+		a, err := typedArg[A](name, q, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		if err := q.leftover(name, 1); err != nil {
+			return nil, err
+		}
+		return typedResult(fun(q.e, a))
+	}, params)
+}
+
+// Adds typed function "fun" with two arguments, see Register0.
+func Register2[A, B, R any](i *Interpreter, name string, fun func(*EnviromentNode, A, B) (R, error), params ...string) error {
+	if fun == nil {
+		return ErrorNilFunction{}
+	}
+	return i.register(name, fun, func(name string, q *argQueue) (Result, error) {
+		a, err := typedArg[A](name, q, 1, 2)
+		if err != nil {
+			return nil, err
+		}
+		b, err := typedArg[B](name, q, 2, 2)
+		if err != nil {
+			return nil, err
+		}
+		if err := q.leftover(name, 2); err != nil {
+			return nil, err
+		}
+		return typedResult(fun(q.e, a, b))
+	}, params)
+}
+
+// Adds typed function "fun" with three arguments, see Register0.
+func Register3[A, B, C, R any](i *Interpreter, name string, fun func(*EnviromentNode, A, B, C) (R, error), params ...string) error {
+	if fun == nil {
+		return ErrorNilFunction{}
+	}
+	return i.register(name, fun, func(name string, q *argQueue) (Result, error) {
+		a, err := typedArg[A](name, q, 1, 3)
+		if err != nil {
+			return nil, err
+		}
+		b, err := typedArg[B](name, q, 2, 3)
+		if err != nil {
+			return nil, err
+		}
+		c, err := typedArg[C](name, q, 3, 3)
+		if err != nil {
+			return nil, err
+		}
+		if err := q.leftover(name, 3); err != nil {
+			return nil, err
+		}
+		return typedResult(fun(q.e, a, b, c))
+	}, params)
+}
+
+// Adds function "fun" called by "call" into registry of the interpreter.
+func (i *Interpreter) register(name string, fun interface{}, call adapter, params []string) error {
+	if i == nil {
+		i = defaultInterpreter
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if err := addFun(i.functions, name, fun, params...); err != nil {
+		return err
+	}
+	f := i.functions[name]
+	f.adapter = call
+	i.functions[name] = f
+	return nil
+}
+
+// Returns argument "n" (counted from 1) of function "name" with "count" arguments, as value of type T.
+func typedArg[T any](name string, q *argQueue, n, count int) (T, error) {
+	v, ok, err := nextArg[T](q)
+	if err != nil {
+		if m, ok := err.(argTypeMismatch); ok {
+			return v, fmt.Errorf("argument %d type missmatch for function %s\ngot %v\nwant %v", n, name, m.got, reflect.TypeOf((*T)(nil)).Elem())
+		}
+		return v, err
+	}
+	if !ok {
+		return v, ErrorArgumentCount{Function: name, Expected: count, Received: n - 1}
+	}
+	return v, nil
+}
+
+// Returns next argument as value of type T like argQueue.next, values of type T are taken without reflection.
+func nextArg[T any](q *argQueue) (T, bool, error) {
+	var zero T
+	for {
+		if len(q.processed) > 0 {
+			v := q.processed[0]
+			q.processed = q.processed[1:]
+			tv, ok := typedValue[T](v)
+			if !ok {
+				return zero, true, argTypeMismatch{reflect.TypeOf(v)}
+			}
+			return tv, true, nil
+		}
+		if len(q.args) == 0 {
+			return zero, false, nil
+		}
+		arg := q.args[0]
+		q.args = q.args[1:]
+		if tv, ok := typedValue[T](arg.value); ok {
+			return tv, true, nil
+		}
+		ri, err := q.e.process(arg.value, arg.pointer)
+		if err != nil {
+			return zero, true, err
+		}
+		if r, ok := ri.(Result); ok {
+			if len(r) == 0 {
+				continue
+			}
+			q.processed = append(q.processed, r[1:]...)
+			ri = r[0]
+		}
+		tv, ok := typedValue[T](ri)
+		if !ok {
+			return zero, true, argTypeMismatch{reflect.TypeOf(ri)}
+		}
+		return tv, true, nil
+	}
+}
+
+// Returns "v" as value of type T, or false if it can't be used as T.
+// Reflection is used only if "v" is not of type T, to convert it like argValue does.
+func typedValue[T any](v interface{}) (T, bool) {
+	if tv, ok := v.(T); ok {
+		return tv, true
+	}
+	rv, ok := argValue(v, reflect.TypeOf((*T)(nil)).Elem())
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	// Zero value of interface type holds nil.
+	tv, _ := rv.Interface().(T)
+	return tv, true
+}
+
+// Returns result "r" of typed function as function results.
+func typedResult[R any](r R, err error) (Result, error) {
+	if err != nil {
+		return nil, err
+	}
+	if rr, ok := interface{}(r).(Result); ok {
+		return rr, nil
+	}
+	return Result{r}, nil
+}
+
+// Calls "call" like callFunction, panics are returned as error.
+func callAdapter(call adapter, name string, q *argQueue) (res Result, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = panicError(r)
+		}
+	}()
+	return call(name, q)
+}
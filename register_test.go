@@ -0,0 +1,201 @@
+package funson
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	errTest := errors.New("test error")
+	in := New()
+	registers := []struct {
+		name string
+		err  error
+	}{
+		{"answer", Register0(in, "answer", func(_ *EnviromentNode) (float64, error) {
+			return 42, nil
+		})},
+		{"upper", Register1(in, "upper", func(_ *EnviromentNode, s string) (string, error) {
+			return strings.ToUpper(s), nil
+		}, "text")},
+		{"repeat", Register2(in, "repeat", func(_ *EnviromentNode, s string, n int) (string, error) {
+			return strings.Repeat(s, n), nil
+		}, "text", "count")},
+		{"between", Register3(in, "between", func(_ *EnviromentNode, v, min, max float64) (bool, error) {
+			return min <= v && v <= max, nil
+		})},
+		{"fields", Register1(in, "fields", func(_ *EnviromentNode, s string) (Result, error) {
+			res := Result{}
+			for _, p := range strings.Split(s, ",") {
+				res = append(res, p)
+			}
+			return res, nil
+		})},
+		{"any", Register1(in, "any", func(_ *EnviromentNode, v interface{}) (interface{}, error) {
+			return v, nil
+		})},
+		{"fail", Register0(in, "fail", func(_ *EnviromentNode) (string, error) {
+			return "", errTest
+		})},
+		{"panic", Register0(in, "panic", func(_ *EnviromentNode) (string, error) {
+			panic(errTest)
+		})},
+	}
+	for _, r := range registers {
+		if r.err != nil {
+			t.Fatalf("Register(%s) error = %v", r.name, r.err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		input   interface{}
+		want    interface{}
+		wantErr error
+	}{
+		{
+			name:  "no arguments",
+			input: []interface{}{"!answer"},
+			want:  float64(42),
+		},
+		{
+			name:  "converted argument",
+			input: []interface{}{"!repeat", "ab", float64(2)},
+			want:  "abab",
+		},
+		{
+			name:  "processed arguments",
+			input: []interface{}{"!upper", []interface{}{"!repeat", "a", []interface{}{"!add", float64(1), float64(1)}}},
+			want:  "AA",
+		},
+		{
+			name:  "with reflective functions",
+			input: []interface{}{"!add", []interface{}{"!answer"}, float64(1)},
+			want:  float64(43),
+		},
+		{
+			name:  "three arguments",
+			input: []interface{}{"!between", float64(2), float64(1), float64(3)},
+			want:  true,
+		},
+		{
+			name:    "multiple results as arguments",
+			input:   []interface{}{"!repeat", []interface{}{"!fields", "x,3"}},
+			wantErr: &EvalError{Stack: []StackFrame{{Function: "repeat"}}, Err: fmt.Errorf("argument 2 type missmatch for function repeat\ngot string\nwant int")},
+		},
+		{
+			name:  "multiple results spread",
+			input: []interface{}{[]interface{}{"!fields", "a,b"}},
+			want:  []interface{}{"a", "b"},
+		},
+		{
+			name:  "nil to interface",
+			input: []interface{}{"!any", nil},
+			want:  nil,
+		},
+		{
+			name:  "unprocessed interface argument",
+			input: []interface{}{"!any", []interface{}{"!answer"}},
+			want:  []interface{}{"!answer"},
+		},
+		{
+			name:  "object call",
+			input: map[string]interface{}{"!": "repeat", "text": "c", "count": float64(3)},
+			want:  "ccc",
+		},
+		{
+			name:    "type mismatch",
+			input:   []interface{}{"!upper", float64(1)},
+			wantErr: &EvalError{Stack: []StackFrame{{Function: "upper"}}, Err: fmt.Errorf("argument 1 type missmatch for function upper\ngot float64\nwant string")},
+		},
+		{
+			name:    "not enough arguments",
+			input:   []interface{}{"!repeat", "a"},
+			wantErr: &EvalError{Stack: []StackFrame{{Function: "repeat"}}, Err: ErrorArgumentCount{Function: "repeat", Expected: 2, Received: 1}},
+		},
+		{
+			name:    "leftover arguments",
+			input:   []interface{}{"!upper", "a", "b"},
+			wantErr: &EvalError{Stack: []StackFrame{{Function: "upper"}}, Err: ErrorArgumentCount{Function: "upper", Expected: 1, Received: 2}},
+		},
+		{
+			name:    "error",
+			input:   []interface{}{"!fail"},
+			wantErr: &EvalError{Stack: []StackFrame{{Function: "fail"}}, Err: errTest},
+		},
+		{
+			name:    "panic",
+			input:   []interface{}{"!panic"},
+			wantErr: &EvalError{Stack: []StackFrame{{Function: "panic"}}, Err: errTest},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := in.Fun(tc.input)
+			if tc.wantErr != nil {
+				if !reflect.DeepEqual(err, tc.wantErr) {
+					t.Fatalf("Fun(%v) error = %#v, want %#v", tc.input, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Fun(%v) = (%#v, %v), want (%#v, nil)", tc.input, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	in := New()
+	if err := Register1[string, string](in, "nil", nil); !reflect.DeepEqual(err, ErrorNilFunction{}) {
+		t.Errorf("Register1(nil) error = %v, want %v", err, ErrorNilFunction{})
+	}
+	fun := func(_ *EnviromentNode, a string) (string, error) { return a, nil }
+	if err := Register1(in, "add", fun); !reflect.DeepEqual(err, ErrorDuplicateFunctionName{Name: "add"}) {
+		t.Errorf("Register1(add) error = %v, want %v", err, ErrorDuplicateFunctionName{Name: "add"})
+	}
+	if err := Register1(in, "f", fun, "a", "b"); !reflect.DeepEqual(err, ErrorParamsMismatch{Name: "f", Params: []string{"a", "b"}}) {
+		t.Errorf("Register1(f) error = %v, want ErrorParamsMismatch", err)
+	}
+}
+
+func benchmarkRegistered(b *testing.B, in *Interpreter) {
+	items := make([]interface{}, 0, 100)
+	for i := 0; i < 100; i++ {
+		items = append(items, []interface{}{"!scale", float64(i), []interface{}{"!scale", float64(i), float64(2)}})
+	}
+	p, err := in.Compile(items)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAddFunCall(b *testing.B) {
+	in := New()
+	if err := in.AddFun("scale", func(_ *EnviromentNode, a, b float64) (float64, error) {
+		return a * b, nil
+	}); err != nil {
+		b.Fatal(err)
+	}
+	benchmarkRegistered(b, in)
+}
+
+func BenchmarkRegister2Call(b *testing.B) {
+	in := New()
+	if err := Register2(in, "scale", func(_ *EnviromentNode, a, b float64) (float64, error) {
+		return a * b, nil
+	}); err != nil {
+		b.Fatal(err)
+	}
+	benchmarkRegistered(b, in)
+}
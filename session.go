@@ -0,0 +1,275 @@
+package funson
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session of interactive functions recorded by Recorder, to be run again by Replayer.
+type Session struct {
+	// Times returned by interpreter's Now, in order of calls.
+	Times []time.Time `json:"times"`
+	// Questions, answers and messages, in order they happened.
+	Events []SessionEvent `json:"events"`
+}
+
+// Kinds of session events.
+const (
+	// Question asked by Prompter.Ask.
+	EventAsk = "ask"
+	// Choice question asked by Prompter.AskChoice.
+	EventChoice = "choice"
+	// Message shown by Prompter.Show, the previous answer was not accepted.
+	EventShow = "show"
+	// Time taken by interpreter's Now, only in ErrorReplayMismatch. Recorded times are in Session.Times.
+	EventTime = "time"
+)
+
+// Event of recorded session.
+type SessionEvent struct {
+	// Kind of event, EventAsk, EventChoice or EventShow.
+	Kind string `json:"kind"`
+	// Asked question, nil for EventShow.
+	Question *Question `json:"question,omitempty"`
+	// Raw answer to question, as returned by the prompter.
+	Answer string `json:"answer"`
+	// Retry is true, if the question is asked again after not accepted answer.
+	Retry bool `json:"retry,omitempty"`
+	// Index of option chosen by answer of EventChoice, counted from 0, or -1 if the answer doesn't choose an option. Nil for other events.
+	Option *int `json:"option,omitempty"`
+	// Shown message of EventShow.
+	Message string `json:"message,omitempty"`
+}
+
+// Returns session decoded from JSON in "r".
+func ReadSession(r io.Reader) (*Session, error) {
+	s := &Session{}
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, fmt.Errorf("session: %w", err)
+	}
+	return s, nil
+}
+
+// Writes session "s" as JSON to "w".
+func (s *Session) Write(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(s)
+}
+
+// Records session of programs run by interpreter.
+// Recording of one program run can be replayed, events of concurrent runs are mixed.
+type Recorder struct {
+	mu       sync.Mutex
+	session  Session
+	prompter Prompter
+	now      func() time.Time
+}
+
+// Returns recorder of interpreter "i", which replaces its Prompter and Now by recording ones.
+// Questions are still asked by the prompter of "i" and time is taken from its Now.
+func Record(i *Interpreter) *Recorder {
+	r := &Recorder{prompter: i.prompter(), now: i.Now}
+	if r.now == nil {
+		r.now = time.Now
+	}
+	i.Prompter = r
+	i.Now = r.Now
+	return r
+}
+
+// Returns copy of session recorded so far.
+func (r *Recorder) Session() *Session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Session{
+		Times:  append([]time.Time{}, r.session.Times...),
+		Events: append([]SessionEvent{}, r.session.Events...),
+	}
+}
+
+// Returns current time of the recorded interpreter and records it.
+func (r *Recorder) Now() time.Time {
+	t := r.now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.session.Times = append(r.session.Times, t)
+	return t
+}
+
+// Records event "e" of question. Retry is set, if the previous event was a message.
+func (r *Recorder) record(e SessionEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n := len(r.session.Events); n > 0 && r.session.Events[n-1].Kind == EventShow {
+		e.Retry = true
+	}
+	r.session.Events = append(r.session.Events, e)
+}
+
+func (r *Recorder) Ask(ctx context.Context, q Question) (string, error) {
+	a, err := r.prompter.Ask(ctx, q)
+	if err != nil {
+		return "", err
+	}
+	r.record(SessionEvent{Kind: EventAsk, Question: &q, Answer: a})
+	return a, nil
+}
+
+func (r *Recorder) AskChoice(ctx context.Context, q Question) (string, error) {
+	a, err := r.prompter.AskChoice(ctx, q)
+	if err != nil {
+		return "", err
+	}
+	r.record(SessionEvent{Kind: EventChoice, Question: &q, Answer: a, Option: chosenOption(q, a)})
+	return a, nil
+}
+
+func (r *Recorder) Show(ctx context.Context, msg string) error {
+	if err := r.prompter.Show(ctx, msg); err != nil {
+		return err
+	}
+	r.record(SessionEvent{Kind: EventShow, Message: msg})
+	return nil
+}
+
+// Returns index of option of question "q" chosen by answer "a", or -1 if it doesn't choose one.
+func chosenOption(q Question, a string) *int {
+	n, err := strconv.Atoi(strings.TrimSpace(a))
+	if err != nil || n < 1 || n > len(q.Options) {
+		n = 0
+	}
+	n--
+	return &n
+}
+
+type ErrorReplayMismatch struct {
+	// Expected event of the session, nil if the session has no more events.
+	Expected *SessionEvent
+	// Happened event.
+	Got SessionEvent
+}
+
+func (e ErrorReplayMismatch) Error() string {
+	if e.Got.Kind == EventTime {
+		return "replay: time is taken more times than recorded"
+	}
+	got := e.Got.Message
+	if e.Got.Question != nil {
+		got = e.Got.Question.Text
+	}
+	if e.Expected == nil {
+		return fmt.Sprintf("replay: %s %q is not in the recording", e.Got.Kind, got)
+	}
+	want := e.Expected.Message
+	if e.Expected.Question != nil {
+		want = e.Expected.Question.Text
+	}
+	return fmt.Sprintf("replay: %s %q differs from recorded %s %q", e.Got.Kind, got, e.Expected.Kind, want)
+}
+
+// Runs programs of interpreter again with recorded session.
+// Questions are answered by recorded answers and the interpreter's Now returns recorded times.
+// Question or message which differs from the next recorded event fails the program with ErrorReplayMismatch.
+// Taking time more times than recorded fails the program too, see Err.
+type Replayer struct {
+	mu      sync.Mutex
+	session *Session
+	events  []SessionEvent
+	times   []time.Time
+	// Error of time taken after recorded times were used up.
+	err error
+}
+
+// Returns replayer of session "s" for interpreter "i", which replaces its Prompter and Now by replaying ones.
+func Replay(i *Interpreter, s *Session) *Replayer {
+	r := &Replayer{session: s, events: s.Events, times: s.Times}
+	i.Prompter = r
+	i.Now = r.Now
+	return r
+}
+
+// Returns events of the session, which were not replayed yet.
+func (r *Replayer) Remaining() []SessionEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]SessionEvent{}, r.events...)
+}
+
+// Returns ErrorReplayMismatch, if time was taken more times than recorded, nil otherwise.
+// Functions of the replayed program (time.Now, input, choose) fail with the error, once it happens.
+func (r *Replayer) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Returns next recorded time.
+// After recorded times are used up, Err returns ErrorReplayMismatch and the last time is returned again, or zero time if there are none.
+func (r *Replayer) Now() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.times) == 0 {
+		if r.err == nil {
+			r.err = ErrorReplayMismatch{Got: SessionEvent{Kind: EventTime}}
+		}
+		if n := len(r.session.Times); n > 0 {
+			return r.session.Times[n-1]
+		}
+		return time.Time{}
+	}
+	t := r.times[0]
+	r.times = r.times[1:]
+	return t
+}
+
+// Returns the next recorded event, if it matches happened event "got".
+func (r *Replayer) next(ctx context.Context, got SessionEvent) (SessionEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return SessionEvent{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return SessionEvent{}, r.err
+	}
+	if len(r.events) == 0 {
+		return SessionEvent{}, ErrorReplayMismatch{Got: got}
+	}
+	e := r.events[0]
+	if e.Kind != got.Kind || e.Message != got.Message || !reflect.DeepEqual(questionOf(e), questionOf(got)) {
+		return SessionEvent{}, ErrorReplayMismatch{Expected: &e, Got: got}
+	}
+	r.events = r.events[1:]
+	return e, nil
+}
+
+// Returns question of event "e", zero question if it has none.
+func questionOf(e SessionEvent) Question {
+	if e.Question == nil {
+		return Question{}
+	}
+	return *e.Question
+}
+
+func (r *Replayer) Ask(ctx context.Context, q Question) (string, error) {
+	e, err := r.next(ctx, SessionEvent{Kind: EventAsk, Question: &q})
+	return e.Answer, err
+}
+
+func (r *Replayer) AskChoice(ctx context.Context, q Question) (string, error) {
+	e, err := r.next(ctx, SessionEvent{Kind: EventChoice, Question: &q})
+	return e.Answer, err
+}
+
+func (r *Replayer) Show(ctx context.Context, msg string) error {
+	_, err := r.next(ctx, SessionEvent{Kind: EventShow, Message: msg})
+	return err
+}
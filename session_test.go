@@ -0,0 +1,96 @@
+package funson
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordReplay(t *testing.T) {
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	program := []interface{}{
+		[]interface{}{"!input", map[string]interface{}{"id": "date", "question": "Date", "predefined": []interface{}{"!time.Format", []interface{}{"!time.Now"}, "02.01.2006"}}},
+		[]interface{}{"!choose", map[string]interface{}{"question": "Pick", "options": []interface{}{"a", "b"}}},
+	}
+	want := []interface{}{"04.03.2021", "b"}
+
+	in := New()
+	in.Now = func() time.Time { return now }
+	in.Prompter = &scriptedPrompter{answers: []string{"", "x", " 2 "}}
+	r := Record(in)
+	got, err := in.Fun(program)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("recorded Fun() = (%#v, %v), want (%#v, nil)", got, err, want)
+	}
+
+	option := func(i int) *int { return &i }
+	wantSession := &Session{
+		Times: []time.Time{now},
+		Events: []SessionEvent{
+			{Kind: EventAsk, Question: &Question{ID: "date", Text: "Date", Predefined: "04.03.2021"}, Answer: ""},
+			{Kind: EventChoice, Question: &Question{Text: "Pick", Options: []string{"a", "b"}}, Answer: "x", Option: option(-1)},
+			{Kind: EventShow, Message: "Choose by entering option number"},
+			{Kind: EventChoice, Question: &Question{Text: "Pick", Options: []string{"a", "b"}}, Answer: " 2 ", Retry: true, Option: option(1)},
+		},
+	}
+	if s := r.Session(); !reflect.DeepEqual(s, wantSession) {
+		t.Fatalf("Session() = %#v, want %#v", s, wantSession)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := r.Session().Write(buf); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	s, err := ReadSession(buf)
+	if err != nil {
+		t.Fatalf("ReadSession() error = %v", err)
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		in := New()
+		in.Now = func() time.Time { return now.Add(48 * time.Hour) }
+		p := Replay(in, s)
+		got, err := in.Fun(program)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("replayed Fun() = (%#v, %v), want (%#v, nil)", got, err, want)
+		}
+		if rest := p.Remaining(); len(rest) != 0 {
+			t.Errorf("Remaining() = %#v, want none", rest)
+		}
+	})
+
+	t.Run("different question", func(t *testing.T) {
+		in := New()
+		Replay(in, s)
+		_, err := in.Fun([]interface{}{"!input", map[string]interface{}{"question": "Other"}})
+		var mismatch ErrorReplayMismatch
+		if !errors.As(err, &mismatch) || mismatch.Expected == nil || mismatch.Got.Question.Text != "Other" {
+			t.Errorf("Fun() error = %v, want ErrorReplayMismatch", err)
+		}
+	})
+
+	t.Run("time not recorded", func(t *testing.T) {
+		in := New()
+		p := Replay(in, s)
+		_, err := in.Fun(append([]interface{}{[]interface{}{"!time.Now"}}, program...))
+		var mismatch ErrorReplayMismatch
+		if !errors.As(err, &mismatch) || mismatch.Got.Kind != EventTime {
+			t.Errorf("Fun() error = %v, want ErrorReplayMismatch of time", err)
+		}
+		if !errors.As(p.Err(), &mismatch) {
+			t.Errorf("Err() = %v, want ErrorReplayMismatch", p.Err())
+		}
+	})
+
+	t.Run("question not recorded", func(t *testing.T) {
+		in := New()
+		Replay(in, s)
+		_, err := in.Fun(append(program, []interface{}{"!input", map[string]interface{}{}}))
+		var mismatch ErrorReplayMismatch
+		if !errors.As(err, &mismatch) || mismatch.Expected != nil {
+			t.Errorf("Fun() error = %v, want ErrorReplayMismatch without expected event", err)
+		}
+	})
+}
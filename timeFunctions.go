@@ -0,0 +1,207 @@
+package funson
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+	// Time zones are embedded, so they can be used also where the system has none.
+	_ "time/tzdata"
+)
+
+// Time argument of time functions, string in RFC 3339 format or time.Time (e.g. from time.Now).
+// Times are passed between time functions as strings, so they can be used as JSON values.
+// Arguments are not processed before the call, like interface{} arguments, toTime processes them.
+type timeValue interface{}
+
+type ErrorUnknownTimeUnit struct{ Unit string }
+
+func (e ErrorUnknownTimeUnit) Error() string {
+	return fmt.Sprintf("unknown time unit: %s", e.Unit)
+}
+
+// Returns time value "v", which is time.Time or string in RFC 3339 format, or program node processed to them in enviroment "en".
+func toTime(en *EnviromentNode, v interface{}) (time.Time, error) {
+	switch v.(type) {
+	case time.Time, string:
+	default:
+		pv, err := singleResult(en.Process(v))
+		if err != nil {
+			return time.Time{}, err
+		}
+		v = pv
+	}
+	switch vt := v.(type) {
+	case time.Time:
+		return vt, nil
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, vt)
+		if err != nil {
+			return time.Time{}, ErrorInvalidDate{Input: vt, Format: time.RFC3339}
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("want time or string in RFC 3339 format: %v", reflect.TypeOf(v))
+}
+
+// Returns time "t" as JSON friendly value.
+func fromTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+// Returns time values "a" and "b", see toTime.
+func toTimes(en *EnviromentNode, a, b interface{}) (time.Time, time.Time, error) {
+	ta, err := toTime(en, a)
+	if err != nil {
+		return ta, ta, err
+	}
+	tb, err := toTime(en, b)
+	return ta, tb, err
+}
+
+func formatTime(en *EnviromentNode, t timeValue, layout string) (string, error) {
+	tt, err := toTime(en, t)
+	if err != nil {
+		return "", err
+	}
+	return tt.Format(layout), nil
+}
+
+func timeParse(_ *EnviromentNode, layout, value string) (string, error) {
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return "", ErrorInvalidDate{Input: value, Format: layout}
+	}
+	return fromTime(t), nil
+}
+
+func timeParseIn(_ *EnviromentNode, layout, value, zone string) (string, error) {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return "", err
+	}
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return "", ErrorInvalidDate{Input: value, Format: layout}
+	}
+	return fromTime(t), nil
+}
+
+func timeIn(en *EnviromentNode, t timeValue, zone string) (string, error) {
+	tt, err := toTime(en, t)
+	if err != nil {
+		return "", err
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return "", err
+	}
+	return fromTime(tt.In(loc)), nil
+}
+
+func timeAdd(en *EnviromentNode, t timeValue, duration string) (string, error) {
+	tt, err := toTime(en, t)
+	if err != nil {
+		return "", err
+	}
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return "", err
+	}
+	return fromTime(tt.Add(d)), nil
+}
+
+func timeAddDate(en *EnviromentNode, t timeValue, years, months, days float64) (string, error) {
+	tt, err := toTime(en, t)
+	if err != nil {
+		return "", err
+	}
+	for _, n := range []struct {
+		name  string
+		value float64
+	}{{"years", years}, {"months", months}, {"days", days}} {
+		if n.value != math.Trunc(n.value) {
+			return "", fmt.Errorf("time.AddDate: %s is not integer: %f", n.name, n.value)
+		}
+	}
+	return fromTime(tt.AddDate(int(years), int(months), int(days))), nil
+}
+
+func timeTruncate(en *EnviromentNode, t timeValue, unit string) (string, error) {
+	tt, err := toTime(en, t)
+	if err != nil {
+		return "", err
+	}
+	y, mo, d := tt.Date()
+	h, mi, _ := tt.Clock()
+	switch unit {
+	case "year":
+		mo, d, h, mi = time.January, 1, 0, 0
+	case "month":
+		d, h, mi = 1, 0, 0
+	case "day":
+		h, mi = 0, 0
+	case "hour":
+		mi = 0
+	case "minute":
+	default:
+		return "", ErrorUnknownTimeUnit{Unit: unit}
+	}
+	return fromTime(time.Date(y, mo, d, h, mi, 0, 0, tt.Location())), nil
+}
+
+// Durations of units of time.Diff function.
+var diffUnits = map[string]time.Duration{
+	"days":    24 * time.Hour,
+	"hours":   time.Hour,
+	"minutes": time.Minute,
+	"seconds": time.Second,
+}
+
+func timeDiff(en *EnviromentNode, from, to timeValue, unit string) (float64, error) {
+	tf, tt, err := toTimes(en, from, to)
+	if err != nil {
+		return 0, err
+	}
+	u, ok := diffUnits[unit]
+	if !ok {
+		return 0, ErrorUnknownTimeUnit{Unit: unit}
+	}
+	return float64(tt.Sub(tf)) / float64(u), nil
+}
+
+func timeWeekday(en *EnviromentNode, t timeValue) (string, error) {
+	tt, err := toTime(en, t)
+	if err != nil {
+		return "", err
+	}
+	return tt.Weekday().String(), nil
+}
+
+func timeUnix(en *EnviromentNode, t timeValue) (float64, error) {
+	tt, err := toTime(en, t)
+	if err != nil {
+		return 0, err
+	}
+	return float64(tt.Unix()) + float64(tt.Nanosecond())/float64(time.Second), nil
+}
+
+func timeFromUnix(_ *EnviromentNode, seconds float64) string {
+	sec, frac := math.Modf(seconds)
+	return fromTime(time.Unix(int64(sec), int64(frac*float64(time.Second))).UTC())
+}
+
+func timeBefore(en *EnviromentNode, a, b timeValue) (bool, error) {
+	ta, tb, err := toTimes(en, a, b)
+	return err == nil && ta.Before(tb), err
+}
+
+func timeAfter(en *EnviromentNode, a, b timeValue) (bool, error) {
+	ta, tb, err := toTimes(en, a, b)
+	return err == nil && ta.After(tb), err
+}
+
+func timeEqual(en *EnviromentNode, a, b timeValue) (bool, error) {
+	ta, tb, err := toTimes(en, a, b)
+	return err == nil && ta.Equal(tb), err
+}
@@ -0,0 +1,62 @@
+package funson
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimeFunctions(t *testing.T) {
+	in := New()
+	in.Now = FixedClock(time.Date(2026, time.January, 31, 22, 30, 15, 0, time.UTC))
+	now := []interface{}{"!time.Now"}
+	tests := []struct {
+		name    string
+		input   interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{"format now", []interface{}{"!time.Format", now, "02.01.2006 15:04"}, "31.01.2026 22:30", false},
+		{"format string", []interface{}{"!time.Format", "2026-02-03T04:05:06+01:00", "15:04 -07:00"}, "04:05 +01:00", false},
+		{"format not time", []interface{}{"!time.Format", "03.02.2026", "2006"}, nil, true},
+		{"parse", []interface{}{"!time.Parse", "02.01.2006 15:04", "03.02.2026 04:05"}, "2026-02-03T04:05:00Z", false},
+		{"parse error", []interface{}{"!time.Parse", "02.01.2006", "2026-02-03"}, nil, true},
+		{"parse in zone", []interface{}{"!time.ParseIn", "02.01.2006 15:04", "01.07.2026 12:00", "Europe/Bratislava"}, "2026-07-01T12:00:00+02:00", false},
+		{"in zone", []interface{}{"!time.In", now, "America/New_York"}, "2026-01-31T17:30:15-05:00", false},
+		{"unknown zone", []interface{}{"!time.In", now, "Nowhere/Nothing"}, nil, true},
+		{"add", []interface{}{"!time.Add", now, "-1h30m"}, "2026-01-31T21:00:15Z", false},
+		{"add wrong duration", []interface{}{"!time.Add", now, "1 day"}, nil, true},
+		{"add date", map[string]interface{}{"!": "time.AddDate", "time": now, "years": float64(0), "months": float64(1), "days": float64(-1)}, "2026-03-02T22:30:15Z", false},
+		{"add date fraction", []interface{}{"!time.AddDate", "2026-01-01T00:00:00Z", float64(0), 1.5, float64(0)}, nil, true},
+		{"truncate day", []interface{}{"!time.Truncate", now, "day"}, "2026-01-31T00:00:00Z", false},
+		{"truncate month in zone", []interface{}{"!time.Truncate", "2026-03-05T01:02:03+01:00", "month"}, "2026-03-01T00:00:00+01:00", false},
+		{"truncate year", []interface{}{"!time.Truncate", now, "year"}, "2026-01-01T00:00:00Z", false},
+		{"truncate unknown unit", []interface{}{"!time.Truncate", now, "week"}, nil, true},
+		{"diff days", []interface{}{"!time.Diff", "2026-01-01T00:00:00Z", now, "days"}, 30.9376736111111, false},
+		{"diff hours", []interface{}{"!time.Diff", now, []interface{}{"!time.Truncate", now, "day"}, "hours"}, -22.504166666666666, false},
+		{"diff unknown unit", []interface{}{"!time.Diff", now, now, "weeks"}, nil, true},
+		{"weekday", []interface{}{"!time.Weekday", now}, "Saturday", false},
+		{"unix", []interface{}{"!time.Unix", "1970-01-02T00:00:01.5Z"}, 86401.5, false},
+		{"from unix", []interface{}{"!time.FromUnix", 86401.5}, "1970-01-02T00:00:01.5Z", false},
+		{"before", []interface{}{"!time.Before", "2026-01-31T23:00:00+01:00", now}, true, false},
+		{"after", []interface{}{"!time.After", "2026-01-31T23:00:00+01:00", now}, false, false},
+		{"equal in other zone", []interface{}{"!time.Equal", "2026-01-31T23:30:15+01:00", now}, true, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := in.Fun(tc.input)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Fun(%v) error = %v, wantErr %v", tc.input, err, tc.wantErr)
+			}
+			if f, ok := got.(float64); ok {
+				// Rounded, so float results can be compared.
+				got = float64(int64(f*1e10)) / 1e10
+				tc.want = float64(int64(tc.want.(float64)*1e10)) / 1e10
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Fun(%v) = %#v, want %#v", tc.input, got, tc.want)
+			}
+		})
+	}
+}